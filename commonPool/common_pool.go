@@ -11,34 +11,134 @@
 package commonPool
 
 import (
+    "context"
+    "fmt"
+    "github.com/xfali/gomem"
+    "github.com/xfali/gomem/internal/event"
+    "github.com/xfali/gomem/internal/leak"
+    "github.com/xfali/gomem/internal/objutil"
+    "github.com/xfali/gomem/internal/stats"
+    "github.com/xfali/gomem/internal/strict"
     "math"
     "sync"
+    "sync/atomic"
     "time"
 )
 
-type CommonPool struct {
-    //对象池缓存大小，当该值比MaxSize还小时，将自动调整为MaxSize。当回收的对象数量大于该值，则Put方法会阻塞
+const (
+    OverflowDrop  = iota //丢弃归还的对象并调用Destroy
+    OverflowBlock        //阻塞等待空闲位置，超过OverflowTimeout后丢弃并调用Destroy
+    OverflowGrow         //将对象保存在额外的空闲列表中，借出时优先使用
+)
+
+//对象类型为interface{}的CommonPool
+type CommonPool = TypedCommonPool[interface{}]
+
+//类型安全的CommonPool，T为池中对象的类型
+//导出字段均为配置项，只能在Init或首次使用之前设置；之后由内部协程并发读取，修改属于数据竞争
+type TypedCommonPool[T any] struct {
+    //对象池缓存大小，当该值比MaxSize还小时，将自动调整为MaxSize。当回收的对象数量大于该值时按OverflowPolicy处理
     MaxIdle     int
     //对象池最大对象数
     MaxSize     int
     //当资源耗尽时的等待资源时间
     WaitTimeout time.Duration
+    //对象的最大生存时间，超过此时间的对象在借出或归还时将被丢弃并按需创建新对象。<=0 表示不限制；默认 0。
+    //对象池以对象本身（指针类型则为其地址）记录创建时间，值相等的对象将共用同一个过期时间
+    MaxLifetime time.Duration
+    //每个对象的最大生存时间随机缩短[0, MaxLifetimeJitter)，避免同时创建的对象同时过期；默认 0
+    MaxLifetimeJitter time.Duration
+    //空闲对象已达到MaxIdle时Put的处理方式，默认 OverflowDrop
+    OverflowPolicy int
+    //OverflowPolicy为OverflowBlock时Put的最长等待时间，默认 0 表示一直等待
+    OverflowTimeout time.Duration
+    //为true时记录借出对象的时间及借出协程的调用栈，通过Leaks查看未归还的对象，用于调试；默认 false。
+    //只跟踪通过Get、Borrow、GetContext借出并通过Put归还的对象
+    DetectLeaks bool
+    //Leaks列出借出超过此时间仍未归还的对象，默认 0 表示列出所有未归还的对象
+    LeakThreshold time.Duration
+    //为true时跟踪对象标识，Put已归还的对象时panic(gomem.ErrDoubleReturn)，
+    //Put不是由对象池借出（或已被丢弃）的对象时panic(gomem.ErrUnknownObject)，用于调试；默认 false。
+    //只检查通过Get、Borrow、GetContext借出并通过Put归还的对象，值相同的可比较对象（如int）视为同一对象
+    Strict bool
+    //为true时Put的[]byte（或*[]byte）在归还前被填充为gomem.PoisonByte，使归还后仍使用对象的问题更易暴露，用于测试；默认 false
+    PoisonOnReturn bool
     //创建对象函数
-    New         func() interface{}
+    New         func() T
+    //释放对象函数，对象因空闲位置不足、超过MaxLifetime或对象池关闭被丢弃时调用，可为nil
+    Destroy     func(T)
 
-    queue       chan interface{}
+    queue       chan T
     curCount    int
+    //对象池创建且尚未丢弃的对象，值相同的对象按数量记录。只有丢弃这些对象时才释放占用的名额
+    owned       map[interface{}]int
+    expires     map[interface{}]time.Time
+    //OverflowGrow时超出MaxIdle的空闲对象
+    overflow    []T
     mutex       sync.Mutex
+    stop        chan bool
+    closed      bool
+    //关闭后借出的对象全部归还时关闭
+    drained     chan bool
+    //借出对象的借出时间，用于统计借出时长
+    lent        map[interface{}][]time.Time
+    waiters     int32
+    stats       stats.Recorder
+    events      event.Dispatcher[T]
+    leaks       leak.Tracker[T]
+    strict      strict.Tracker
 
-    init bool
+    initOnce sync.Once
+    initErr  error
 }
 
-//不支持获取channel、支持回收channel，禁止使用
-func (p *CommonPool) Init() (<-chan interface{}, chan<- interface{}) {
-    if p.init {
-        return p.queue, p.queue
+//根据cfg中的配置创建并初始化CommonPool，配置不合法时返回gomem.ErrInvalidConfig。
+//对象池使用cfg配置的副本，创建后修改cfg不会影响对象池；返回的对象池的配置项同样不能再修改
+func NewTypedCommonPool[T any](cfg *TypedCommonPool[T]) (*TypedCommonPool[T], error) {
+    p := &TypedCommonPool[T]{}
+    objutil.CopyExported(p, cfg)
+    if err := p.lazyInit(); err != nil {
+        return nil, err
+    }
+    return p, nil
+}
+
+func NewCommonPool(cfg *CommonPool) (*CommonPool, error) {
+    return NewTypedCommonPool(cfg)
+}
+
+//不支持获取channel、支持回收channel，禁止使用。可重复、并发调用，只初始化一次；配置不合法时panic。
+//未调用Init时其他方法将自动初始化对象池
+func (p *TypedCommonPool[T]) Init() (<-chan T, chan<- T) {
+    if err := p.lazyInit(); err != nil {
+        panic(err)
+    }
+    return p.queue, p.queue
+}
+
+func (p *TypedCommonPool[T]) lazyInit() error {
+    p.initOnce.Do(func() {
+        if p.initErr = p.validate(); p.initErr == nil {
+            p.start()
+        }
+    })
+    return p.initErr
+}
+
+func (p *TypedCommonPool[T]) validate() error {
+    if p.New == nil {
+        return fmt.Errorf("%w: New is nil", gomem.ErrInvalidConfig)
+    }
+    if p.MaxSize < 0 || p.MaxIdle < 0 {
+        return fmt.Errorf("%w: MaxSize and MaxIdle must not be negative", gomem.ErrInvalidConfig)
+    }
+    if p.OverflowPolicy < OverflowDrop || p.OverflowPolicy > OverflowGrow {
+        return fmt.Errorf("%w: unknown OverflowPolicy %d", gomem.ErrInvalidConfig, p.OverflowPolicy)
     }
-    p.init = true
+    return nil
+}
+
+func (p *TypedCommonPool[T]) start() {
     if p.MaxIdle == 0 {
         p.MaxIdle = 16
     }
@@ -52,49 +152,425 @@ func (p *CommonPool) Init() (<-chan interface{}, chan<- interface{}) {
         p.WaitTimeout = time.Duration(math.MaxInt64)
     }
     if p.queue == nil {
-        p.queue = make(chan interface{}, p.MaxIdle)
+        p.queue = make(chan T, p.MaxIdle)
     }
+    p.stop = make(chan bool)
+    p.drained = make(chan bool)
     p.curCount = 0
+    p.owned = map[interface{}]int{}
+    p.expires = map[interface{}]time.Time{}
+    p.lent = map[interface{}][]time.Time{}
+}
 
-    return p.queue, p.queue
+//立即关闭对象池并丢弃所有空闲对象，不等待借出的对象归还，相当于使用已结束的ctx调用Shutdown
+func (p *TypedCommonPool[T]) Close() {
+    ctx, cancel := context.WithCancel(context.Background())
+    cancel()
+    p.Shutdown(ctx)
 }
 
-func (p *CommonPool) Close() {
-    //close(p.queue)
+//关闭对象池：新的借用者及正在等待的借用者获得gomem.ErrClosed，丢弃所有空闲对象，
+//等待借出的对象归还并逐个丢弃，直到全部归还或ctx结束。返回ctx结束时仍未归还的对象数量及ctx的错误，
+//重复调用时返回gomem.ErrClosed
+func (p *TypedCommonPool[T]) Shutdown(ctx context.Context) (int, error) {
+    if err := p.lazyInit(); err != nil {
+        return 0, err
+    }
+    p.mutex.Lock()
+    if p.closed {
+        p.mutex.Unlock()
+        return 0, gomem.ErrClosed
+    }
+    p.closed = true
+    close(p.stop)
+    p.drainIdle()
+    p.mutex.Unlock()
+
+    var err error
+    select {
+    case <-p.drained:
+    case <-ctx.Done():
+        err = ctx.Err()
+    }
+    p.events.Close()
+    p.mutex.Lock()
+    defer p.mutex.Unlock()
+    if p.curCount == 0 {
+        return 0, nil
+    }
+    return p.curCount, err
 }
 
-func (p *CommonPool) make() interface{} {
+//关闭后丢弃空闲对象。调用者需持有mutex
+func (p *TypedCommonPool[T]) drainIdle() {
+    for _, o := range p.overflow {
+        p.discard(o)
+    }
+    p.overflow = nil
+    for {
+        select {
+        case o := <-p.queue:
+            p.discard(o)
+            continue
+        default:
+        }
+        break
+    }
+    p.checkDrained()
+}
+
+//丢弃对象，对象由对象池创建时释放其占用的名额。调用者需持有mutex
+func (p *TypedCommonPool[T]) discard(o T) {
+    key := objutil.Key(o)
+    delete(p.expires, key)
+    if n := p.owned[key]; n > 0 {
+        if n == 1 {
+            delete(p.owned, key)
+        } else {
+            p.owned[key] = n - 1
+        }
+        p.curCount--
+    }
+    p.stats.Destroyed.Add(1)
+    p.events.Emit(gomem.EventDestroy, o, gomem.INVALID, 0)
+    if p.Strict {
+        p.strict.Forget(o)
+    }
+    if p.Destroy != nil {
+        p.Destroy(o)
+    }
+    p.checkDrained()
+}
+
+//OverflowGrow时取出额外保存的空闲对象
+func (p *TypedCommonPool[T]) popOverflow() (T, bool) {
+    p.mutex.Lock()
+    defer p.mutex.Unlock()
+
+    var zero T
+    if len(p.overflow) == 0 {
+        return zero, false
+    }
+    o := p.overflow[len(p.overflow)-1]
+    p.overflow[len(p.overflow)-1] = zero
+    p.overflow = p.overflow[:len(p.overflow)-1]
+    return o, true
+}
+
+//关闭后借出的对象全部归还时通知Shutdown。调用者需持有mutex
+func (p *TypedCommonPool[T]) checkDrained() {
+    if !p.closed || p.curCount > 0 {
+        return
+    }
+    select {
+    case <-p.drained:
+    default:
+        close(p.drained)
+    }
+}
+
+func (p *TypedCommonPool[T]) isClosed() bool {
+    p.mutex.Lock()
+    defer p.mutex.Unlock()
+
+    return p.closed
+}
+
+//返回false, nil表示已达到MaxSize
+func (p *TypedCommonPool[T]) make() (T, bool, error) {
     p.mutex.Lock()
     defer p.mutex.Unlock()
 
+    var o T
+    if p.closed {
+        return o, false, gomem.ErrClosed
+    }
     if p.curCount < p.MaxSize {
+        o = p.New()
+        if objutil.IsNil(o) {
+            return o, false, gomem.ErrFactory
+        }
         p.curCount++
-        return p.New()
+        p.owned[objutil.Key(o)]++
+        p.stats.Created.Add(1)
+        p.events.Emit(gomem.EventCreate, o, -1, 0)
+        if p.MaxLifetime > 0 {
+            p.expires[objutil.Key(o)] = objutil.Expiry(time.Now(), p.MaxLifetime, p.MaxLifetimeJitter)
+        }
+        return o, true, nil
     }
-    return nil
+    return o, false, nil
+}
+
+//对象已超过MaxLifetime时将其丢弃并释放占用的名额，返回true。from为对象当前的状态
+func (p *TypedCommonPool[T]) discardExpired(o T, from int) bool {
+    if p.MaxLifetime <= 0 {
+        return false
+    }
+    p.mutex.Lock()
+    defer p.mutex.Unlock()
+
+    if expire, ok := p.expires[objutil.Key(o)]; ok && objutil.Expired(expire) {
+        p.stats.Evicted.Add(1)
+        p.events.Emit(gomem.EventEvict, o, from, 0)
+        p.discard(o)
+        return true
+    }
+    return false
 }
 
-func (p *CommonPool) Get() interface{} {
-    var ret interface{}
+//失败时返回T的零值
+func (p *TypedCommonPool[T]) Get() T {
+    ret, _ := p.Borrow()
+    return ret
+}
+
+//等待WaitTimeout仍未获得对象时返回ErrTimeout
+func (p *TypedCommonPool[T]) Borrow() (T, error) {
+    start := time.Now()
+    atomic.AddInt32(&p.waiters, 1)
+    o, err := p.borrow()
+    atomic.AddInt32(&p.waiters, -1)
+    p.borrowed(o, start, err)
+    return o, err
+}
 
-    if len(p.queue) == 0 {
-        ret = p.make()
-        if ret != nil {
-            return ret
+func (p *TypedCommonPool[T]) borrow() (T, error) {
+    var zero T
+    if err := p.lazyInit(); err != nil {
+        return zero, err
+    }
+    if p.isClosed() {
+        return zero, gomem.ErrClosed
+    }
+    timer := time.NewTimer(p.WaitTimeout)
+    defer timer.Stop()
+
+    for {
+        if ret, ok := p.popOverflow(); ok {
+            if p.discardExpired(ret, gomem.IDLE) {
+                continue
+            }
+            return ret, nil
+        }
+        if len(p.queue) == 0 {
+            ret, ok, err := p.make()
+            if ok || err != nil {
+                return ret, err
+            }
         }
+        select {
+        case ret := <-p.queue:
+            if p.discardExpired(ret, gomem.IDLE) {
+                continue
+            }
+            return ret, nil
+        case <-p.stop:
+            return zero, gomem.ErrClosed
+        case <-timer.C:
+            ret, ok, err := p.make()
+            if !ok && err == nil {
+                return ret, gomem.ErrTimeout
+            }
+            return ret, err
+        }
+    }
+}
+
+//与Get相同，但等待时间由ctx控制，WaitTimeout对此方法无效
+func (p *TypedCommonPool[T]) GetContext(ctx context.Context) (T, error) {
+    start := time.Now()
+    atomic.AddInt32(&p.waiters, 1)
+    o, err := p.getContext(ctx)
+    atomic.AddInt32(&p.waiters, -1)
+    p.borrowed(o, start, err)
+    return o, err
+}
+
+func (p *TypedCommonPool[T]) getContext(ctx context.Context) (T, error) {
+    var zero T
+    if err := ctx.Err(); err != nil {
+        return zero, err
+    }
+    if err := p.lazyInit(); err != nil {
+        return zero, err
+    }
+    if p.isClosed() {
+        return zero, gomem.ErrClosed
+    }
+    for {
+        if ret, ok := p.popOverflow(); ok {
+            if p.discardExpired(ret, gomem.IDLE) {
+                continue
+            }
+            return ret, nil
+        }
+        if len(p.queue) == 0 {
+            ret, ok, err := p.make()
+            if ok || err != nil {
+                return ret, err
+            }
+        }
+        select {
+        case ret := <-p.queue:
+            if p.discardExpired(ret, gomem.IDLE) {
+                continue
+            }
+            return ret, nil
+        case <-p.stop:
+            return zero, gomem.ErrClosed
+        case <-ctx.Done():
+            return zero, ctx.Err()
+        }
+    }
+}
+
+//已超过MaxLifetime的对象，及对象池关闭后归还的对象将被丢弃；空闲对象已达到MaxIdle时按OverflowPolicy处理
+func (p *TypedCommonPool[T]) Put(i T) {
+    if p.lazyInit() != nil {
+        return
+    }
+    if p.Strict {
+        if err := p.strict.Return(i, false); err != nil {
+            panic(fmt.Errorf("commonPool: put %T: %w", i, err))
+        }
+    }
+    p.returned(i)
+    if p.DetectLeaks {
+        p.leaks.Return(i)
+    }
+    if p.PoisonOnReturn {
+        strict.Poison(i)
+    }
+    if p.discardExpired(i, gomem.ALLOCATED) {
+        return
+    }
+    p.mutex.Lock()
+    if p.closed {
+        p.discard(i)
+        p.mutex.Unlock()
+        return
     }
     select {
-    case ret = <-p.queue:
-        return ret
-    case <-time.After(p.WaitTimeout):
-        break
+    case p.queue <- i:
+        p.mutex.Unlock()
+        return
+    default:
     }
-    if ret == nil {
-        return p.make()
+    switch p.OverflowPolicy {
+    case OverflowGrow:
+        p.overflow = append(p.overflow, i)
+        p.mutex.Unlock()
+        return
+    case OverflowBlock:
+        p.mutex.Unlock()
+    default:
+        p.discard(i)
+        p.mutex.Unlock()
+        return
     }
-    return ret
+
+    var timeout <-chan time.Time
+    if p.OverflowTimeout > 0 {
+        timer := time.NewTimer(p.OverflowTimeout)
+        defer timer.Stop()
+        timeout = timer.C
+    }
+    select {
+    case p.queue <- i:
+        //等待期间对象池被关闭，放入的对象需要丢弃
+        if p.isClosed() {
+            p.mutex.Lock()
+            p.drainIdle()
+            p.mutex.Unlock()
+        }
+    case <-p.stop:
+        p.mutex.Lock()
+        p.discard(i)
+        p.mutex.Unlock()
+    case <-timeout:
+        p.mutex.Lock()
+        p.discard(i)
+        p.mutex.Unlock()
+    }
+}
+
+//返回对象池的统计信息，可与借用、归还并发调用
+func (p *TypedCommonPool[T]) Stats() gomem.PoolStats {
+    p.mutex.Lock()
+    idle := len(p.queue) + len(p.overflow)
+    active := p.curCount - idle
+    p.mutex.Unlock()
+    s := p.stats.Snapshot(idle, active, int(atomic.LoadInt32(&p.waiters)))
+    s.DroppedEvents = p.events.Dropped()
+    return s
+}
+
+//添加生命周期监听器，可在任意时刻调用，见gomem.TypedPoolListener
+func (p *TypedCommonPool[T]) AddListener(l gomem.TypedPoolListener[T]) {
+    p.events.Add(l)
+}
+
+//成功借出时记录借出时间及等待时间，超时时计数，并通知借出或超时事件
+func (p *TypedCommonPool[T]) borrowed(o T, start time.Time, err error) {
+    now := time.Now()
+    if err != nil {
+        if stats.IsTimeout(err) {
+            p.stats.Timeouts.Add(1)
+            p.events.Emit(gomem.EventTimeout, o, -1, now.Sub(start))
+        }
+        return
+    }
+    if p.Strict {
+        p.strict.Borrow(o)
+    }
+    if p.DetectLeaks {
+        p.leaks.Borrow(o)
+    }
+    p.stats.Borrowed.Add(1)
+    p.stats.BorrowWait.Observe(now.Sub(start))
+    p.events.Emit(gomem.EventBorrow, o, gomem.IDLE, now.Sub(start))
+    key := objutil.Key(o)
+    p.mutex.Lock()
+    p.lent[key] = append(p.lent[key], now)
+    p.mutex.Unlock()
+}
+
+//记录对象的借出时长并通知归还事件
+func (p *TypedCommonPool[T]) returned(o T) {
+    p.stats.Returned.Add(1)
+    key := objutil.Key(o)
+    p.mutex.Lock()
+    defer p.mutex.Unlock()
+    var active time.Duration
+    if ts := p.lent[key]; len(ts) > 0 {
+        active = time.Since(ts[len(ts)-1])
+        p.stats.ActiveTime.Observe(active)
+        if len(ts) == 1 {
+            delete(p.lent, key)
+        } else {
+            p.lent[key] = ts[:len(ts)-1]
+        }
+    }
+    p.events.Emit(gomem.EventReturn, o, gomem.ALLOCATED, active)
+}
+
+//借出对象并返回其句柄，调用句柄的Release归还对象。DetectLeaks为true时句柄未Release即被垃圾回收将记录日志
+func (p *TypedCommonPool[T]) BorrowHandle() (*gomem.TypedHandle[T], error) {
+    o, err := p.Borrow()
+    if err != nil {
+        return nil, err
+    }
+    if !p.DetectLeaks {
+        return gomem.NewTypedHandle(o, p.Put), nil
+    }
+    return p.leaks.Handle("commonPool", o, p.Put), nil
 }
 
-func (p *CommonPool) Put(i interface{}) {
-    p.queue <- i
+//借出超过LeakThreshold仍未归还的对象及其借出时的调用栈，按借出时间排序。DetectLeaks为false时返回nil
+func (p *TypedCommonPool[T]) Leaks() []gomem.TypedLeakInfo[T] {
+    if !p.DetectLeaks {
+        return nil
+    }
+    return p.leaks.Leaks(p.LeakThreshold)
 }
@@ -0,0 +1,80 @@
+/**
+ * Copyright (C) 2019, Xiongfa Li.
+ * All right reserved.
+ * @author xiongfa.li
+ * @date 2019/2/27
+ * @time 11:05
+ * @version V1.0
+ * Description: 
+ */
+
+package commonPool
+
+import (
+    "github.com/xfali/gomem"
+    "log"
+    "time"
+)
+
+//RemoveAbandonedOnBorrow为true时通知内部协程检查被遗弃的对象
+func (p *TypedCommonPool[T]) checkAbandoned() {
+    if !p.RemoveAbandonedOnBorrow {
+        return
+    }
+    select {
+    case p.abandonChan <- true:
+    case <-p.stop:
+    }
+}
+
+//销毁借出超过RemoveAbandonedTimeout的对象，并释放其占用的MaxSize名额。只能由内部协程调用
+func (p *TypedCommonPool[T]) removeAbandoned() {
+    now := time.Now()
+    for key, pos := range p.active {
+        for i := len(pos) - 1; i >= 0; i-- {
+            po := pos[i]
+            if now.Sub(po.lastBorrow) <= p.RemoveAbandonedTimeout {
+                continue
+            }
+            p.events.Emit(gomem.EventInvalidate, po.obj, po.state, now.Sub(po.lastBorrow))
+            po.state = ABANDONED
+            if p.LogAbandoned {
+                p.logAbandoned(po)
+            }
+            p.removeActive(key, i)
+            pos = p.active[key]
+            p.destoryObj(po.obj)
+            p.rememberAbandoned(key)
+        }
+    }
+}
+
+//记录被遗弃的对象，使其归还时被忽略而不是当作其他借出的对象。只能由内部协程调用
+func (p *TypedCommonPool[T]) rememberAbandoned(key interface{}) {
+    if len(p.abandoned) >= p.MaxSize {
+        //不会再归还的对象不能一直占用内存，丢弃任意一条记录
+        for k := range p.abandoned {
+            delete(p.abandoned, k)
+            break
+        }
+    }
+    p.abandoned[key]++
+}
+
+func (p *TypedCommonPool[T]) forgetAbandoned(key interface{}) {
+    if p.abandoned[key] <= 1 {
+        delete(p.abandoned, key)
+    } else {
+        p.abandoned[key]--
+    }
+}
+
+func (p *TypedCommonPool[T]) logAbandoned(po *poolObject[T]) {
+    if stack := po.stack.Load(); stack != nil {
+        log.Printf("commonPool2: abandoned object %v borrowed at %s, stack:\n%s",
+            po.obj, po.lastBorrow.Format(time.RFC3339Nano), *stack)
+    } else {
+        log.Printf("commonPool2: abandoned object %v borrowed at %s",
+            po.obj, po.lastBorrow.Format(time.RFC3339Nano))
+    }
+}
@@ -0,0 +1,83 @@
+/**
+ * Copyright (C) 2019, Xiongfa Li.
+ * All right reserved.
+ * @author xiongfa.li
+ * @date 2019/3/20
+ * @time 14:15
+ * @version V1.0
+ * Description: 
+ */
+
+package commonPool
+
+import (
+    "github.com/xfali/gomem"
+    "github.com/xfali/gomem/internal/objutil"
+    "time"
+)
+
+const (
+    breakerClosed   = iota //正常创建对象
+    breakerOpen            //熔断中，不创建对象，没有空闲对象时借用者立即获得ErrCircuitOpen
+    breakerHalfOpen        //熔断结束，只允许一次试探创建
+)
+
+//当前是否可以创建对象：未处于熔断且已过重试等待时间，试探期间只允许一个对象正在创建。只能由内部协程调用
+func (p *TypedCommonPool[T]) creatable() bool {
+    switch p.breaker {
+    case breakerOpen:
+        return false
+    case breakerHalfOpen:
+        if p.creating > 0 {
+            return false
+        }
+    }
+    return !time.Now().Before(p.nextCreate)
+}
+
+//没有空闲对象时，借用者是否应立即获得ErrCircuitOpen。只能由内部协程调用
+func (p *TypedCommonPool[T]) failFast() bool {
+    return p.breaker == breakerOpen || (p.breaker == breakerHalfOpen && p.creating > 0)
+}
+
+//记录一次创建结果。失败且还可以重试时返回true，此时按退避时间稍后重试，失败信息不交给借用者；
+//连续失败达到BreakerThreshold或试探失败时开始熔断。只能由内部协程调用
+func (p *TypedCommonPool[T]) recordCreate(err error) bool {
+    if err == nil {
+        p.createFailures = 0
+        p.createRetries = 0
+        p.breaker = breakerClosed
+        p.nextCreate = time.Time{}
+        return false
+    }
+    p.createFailures++
+    if p.breaker == breakerHalfOpen || (p.BreakerThreshold > 0 && p.createFailures >= p.BreakerThreshold) {
+        p.breaker = breakerOpen
+        p.createRetries = 0
+        p.resetRetryTimer(time.Now().Add(p.BreakerCooldown))
+        return false
+    }
+    if p.createRetries < p.CreateRetries {
+        p.createRetries++
+        p.nextCreate = time.Now().Add(objutil.Backoff(p.CreateRetryBackoff, p.CreateRetryMaxBackoff, p.createRetries))
+        p.resetRetryTimer(p.nextCreate)
+        return true
+    }
+    p.createRetries = 0
+    return false
+}
+
+//重试等待结束，或熔断结束进入试探。只能由内部协程调用
+func (p *TypedCommonPool[T]) retryCreate() {
+    if p.breaker == breakerOpen {
+        p.breaker = breakerHalfOpen
+        //熔断期间未被取走的错误不再需要，以便立即试探创建
+        if p.pendingErr == gomem.ErrCircuitOpen {
+            p.pendingErr = nil
+        }
+    }
+}
+
+func (p *TypedCommonPool[T]) resetRetryTimer(at time.Time) {
+    p.retryTimer.Reset(time.Until(at))
+}
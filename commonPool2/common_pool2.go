@@ -12,32 +12,43 @@ package commonPool
 
 import (
     "container/list"
+    "context"
+    "fmt"
+    "github.com/xfali/gomem"
+    "github.com/xfali/gomem/internal/event"
+    "github.com/xfali/gomem/internal/objutil"
+    "github.com/xfali/gomem/internal/stats"
+    "github.com/xfali/gomem/internal/strict"
+    "runtime/debug"
+    "sync"
+    "sync/atomic"
     "time"
 )
 
-type PooledObjectFactory interface {
-    //对象被激活时调用
-    ActivateObject(interface{})
-    //对象处于idle状态，被定时释放时调用
-    DestroyObject(interface{})
-    //创建对象时调用
-    MakeObject() interface{}
-    //对象回收之后进入idle状态时被调用
-    PassivateObject(interface{})
-    //验证对象是否有效
-    ValidateObject(interface{}) bool
-}
-
-type CommonPool struct {
-    //池中最小保留的idle对象的数量，默认8
+//对象类型为interface{}的CommonPool
+type CommonPool = TypedCommonPool[interface{}]
+
+//类型安全的CommonPool，T为池中对象的类型
+//导出字段均为配置项，只能在Init或首次使用之前设置；之后由内部协程并发读取，修改属于数据竞争
+type TypedCommonPool[T any] struct {
+    //池中最小保留的idle对象的数量，默认8。资源回收协程每次执行后将空闲对象补充到此数量，Prewarm也以此为目标
     MinIdle int
     //最大对象数量,默认32
     MaxSize int
-    //获取资源的等待时间,BlockWhenExhausted 为 true 时有效。-1 代表无时间限制，一直阻塞直到有可用的资源
+    //获取资源的等待时间,BlockWhenExhausted 为 true 时有效。-1 代表无时间限制，一直阻塞直到有可用的资源；默认 -1。
+    //未设置（0）时按-1处理，不影响MaxSize
     MaxWaitMillis time.Duration
     //对象空闲的最小时间，达到此值后空闲对象将可能会被移除。-1 表示不移除；默认 30 分钟
     MinEvictableIdleTimeMillis time.Duration
-    //资源回收协程执行一次回收操作，回收资源的数量。默认 3
+    //对象空闲的最小时间，达到此值且空闲对象多于MinIdle时将可能会被移除，是否使用取决于EvictionPolicy。-1 表示不移除；默认 -1
+    SoftMinEvictableIdleTimeMillis time.Duration
+    //回收策略，决定被检查的空闲对象是否需要移除，默认 gomem.DefaultEvictionPolicy
+    EvictionPolicy gomem.EvictionPolicy
+    //对象的最大生存时间，超过此时间的对象在借出、归还或被资源回收协程检查时将被销毁。<=0 表示不限制；默认 0
+    MaxLifetime time.Duration
+    //每个对象的最大生存时间随机缩短[0, MaxLifetimeJitter)，避免同时创建的对象同时过期；默认 0
+    MaxLifetimeJitter time.Duration
+    //资源回收协程执行一次回收操作，检查资源的数量，多次执行时依次检查所有空闲对象。负数 -n 表示检查空闲对象数量的 1/n；默认 3
     NumTestsPerEvictionRun int
     //创建对象时是否调用 Factory.ValidateObject 方法，默认 false
     TestOnCreate bool
@@ -45,294 +56,1011 @@ type CommonPool struct {
     TestOnBorrow bool
     //释放对象时是否调用 Factory.ValidateObject 方法，默认 false
     TestOnReturn bool
-    //对象空闲时是否调用 Factory.ValidateObject 方法，默认 false
+    //资源回收协程检查空闲对象时是否调用 Factory.ValidateObject 方法，默认 false
     TestWhileIdle bool
     //回收资源协程的执行周期，默认 -1 表示不定时回收
     TimeBetweenEvictionRunsMillis time.Duration
     //资源耗尽时，是否阻塞等待获取资源，默认 false
     BlockWhenExhausted bool
-    //是否接受外部Object，默认false(暂时没有作用)
+    //空闲对象是否后进先出，默认 false 即先进先出。为true时优先借出最近归还的对象，长时间未被使用的对象可被资源回收协程移除
+    Lifo bool
+    //资源耗尽时阻塞等待的借用者是否按到达顺序获取对象，默认 false。
+    //为true时归还的对象交给仍在等待的最早的借用者，等待超时由内部协程统一处理
+    Fairness bool
+    //为高优先级借用者保留的对象数量，默认 0。借出对象数量达到MaxSize-ReservedCapacity后，
+    //只有通过GetWithPriority且优先级高于ReservedPriority的借用者可以借出对象
+    ReservedCapacity int
+    //可以使用保留对象的优先级下限（不含），默认 0，即Get、Borrow、GetContext等不能使用保留的对象
+    ReservedPriority int
+    //同时在后台创建对象的最大协程数量，默认 0 表示在内部协程中同步创建。
+    //大于0时Factory.MakeObject不再阻塞内部协程，正在创建的对象占用MaxSize名额，阻塞等待的借用者总是按到达顺序排队
+    MaxConcurrentCreates int
+    //借用者触发的创建失败后的重试次数，默认 0。重试期间借用者继续等待，重试均失败后才获得错误
+    CreateRetries int
+    //第一次重试前的等待时间，之后每次翻倍并随机缩短至多一半，默认 100 毫秒
+    CreateRetryBackoff time.Duration
+    //重试前的最大等待时间，默认 10 秒
+    CreateRetryMaxBackoff time.Duration
+    //连续创建失败达到此次数后熔断，默认 0 表示不熔断。熔断期间不再创建对象，没有空闲对象时借用者立即获得gomem.ErrCircuitOpen
+    BreakerThreshold int
+    //熔断持续时间，结束后只允许一次试探创建，成功则恢复，失败则重新熔断，默认 5 秒
+    BreakerCooldown time.Duration
+    //是否接受外部Object，默认false。为false时Put找不到借出记录的对象（如借出后被修改的值类型对象）视为最早借出且未归还的对象归还，
+    //没有未归还的对象时忽略；为true时在未达到MaxSize时将其加入对象池，否则销毁
     AcceptExternalObj bool
+    //为true时跟踪对象标识，Put已归还的对象时panic(gomem.ErrDoubleReturn)，AcceptExternalObj为false时
+    //Put不是由对象池借出（或已被销毁）的对象将panic(gomem.ErrUnknownObject)，用于调试；默认 false。
+    //值相同的可比较对象（如int）视为同一对象
+    Strict bool
+    //为true时Put的[]byte（或*[]byte）在归还前被填充为gomem.PoisonByte，使归还后仍使用对象的问题更易暴露，用于测试；默认 false
+    PoisonOnReturn bool
+    //获取对象时是否清理被遗弃的对象，仅在空闲对象少于2个且借出对象数大于MaxSize-3时进行，默认 false
+    RemoveAbandonedOnBorrow bool
+    //资源回收协程执行时是否清理被遗弃的对象，默认 false
+    RemoveAbandonedOnMaintenance bool
+    //对象被借出超过此时间未归还即视为被遗弃，将被销毁并释放占用的MaxSize名额，默认 5 分钟
+    RemoveAbandonedTimeout time.Duration
+    //是否记录借出对象的协程调用栈，并在对象被遗弃时输出到日志，默认 false
+    LogAbandoned bool
     //对象工厂
-    Factory PooledObjectFactory
+    Factory TypedPooledObjectFactory[T]
+    //可返回错误的对象工厂，与Factory二选一，同时设置时优先使用FallibleFactory
+    FallibleFactory TypedFallibleObjectFactory[T]
 
     //inner vars
-    getChan  chan interface{}
-    putChan  chan interface{}
-    stop     chan bool
-    curCount int
-    init     bool
+    getChan     chan T
+    borrowChan  chan borrowResult[T]
+    tryChan     chan chan borrowResult[T]
+    putChan     chan T
+    abandonChan chan bool
+    cmdChan     chan func()
+    waitChan    chan *waiter[T]
+    createdChan chan created[T]
+    stop        chan bool
+    closing     chan bool
+    drained     chan bool
+    closed      int32
+    waiters     int32
+    initOnce    sync.Once
+    initErr     error
+    factory     TypedFallibleObjectFactory[T]
+    stats       stats.Recorder
+    events      event.Dispatcher[T]
+    strict      strict.Tracker
+
+    //以下变量只能由内部协程访问
+    queue      *list.List
+    evictNext  *list.Element
+    active     map[interface{}][]*poolObject[T]
+    //已被当作遗弃对象销毁的对象，归还时忽略，最多记录MaxSize个
+    abandoned  map[interface{}]int
+    curCount   int
+    creating   int
+    pendingErr error
+    //Shutdown后不再借出、创建对象，归还的对象直接销毁，借出的对象全部归还后关闭drained
+    shuttingDown  bool
+    drainedClosed bool
+    //创建失败重试及熔断状态
+    breaker        int
+    createFailures int
+    createRetries  int
+    nextCreate     time.Time
+    retryTimer     *time.Timer
+    //Fairness为true时按到达顺序排队的等待者，及唯一的等待超时定时器
+    waitQueue    *list.List
+    waitTimer    *time.Timer
+    waitDeadline time.Time
 }
 
+//对象的状态，与gomem中的同名常量相同，用于生命周期事件的From
 const (
-    IDLE       = iota //在池中，处于空闲状态
-    ALLOCATED         //被使用中
-    EVICTION          //正在被逐出器验证
-    VALIDATION        //正在验证
-    INVALID           //驱逐测试或验证失败并将被销毁
-    ABANDONED         //对象被客户端拿出后，长时间未返回池中，或没有调用 use 方法，即被标记为抛弃的
-    READY             //可以被给客户端使用
+    IDLE       = gomem.IDLE       //在池中，处于空闲状态
+    ALLOCATED  = gomem.ALLOCATED  //被使用中
+    EVICTION   = gomem.EVICTION   //正在被逐出器验证
+    VALIDATION = gomem.VALIDATION //正在验证
+    INVALID    = gomem.INVALID    //驱逐测试或验证失败并将被销毁
+    ABANDONED  = gomem.ABANDONED  //对象被客户端拿出后，长时间未返回池中，或没有调用 use 方法，即被标记为抛弃的
+    READY      = gomem.READY      //可以被给客户端使用
 )
 
-type poolObject struct {
+type poolObject[T any] struct {
     when  time.Time
     state int
-    obj   interface{}
+    obj   T
+
+    //创建时间
+    created time.Time
+    //过期时间，零值表示永不过期
+    expire time.Time
+    //最近一次被借出的时间
+    lastBorrow time.Time
+    //最近一次被归还的时间
+    lastReturn time.Time
+    //被借出的次数
+    borrowCount int64
+    //LogAbandoned为true时，借出对象的协程调用栈
+    stack atomic.Pointer[[]byte]
 }
 
-func (p *CommonPool) initDefault() {
-    if p.Factory == nil {
-        panic("Factory is Empty")
+func (p *TypedCommonPool[T]) newPoolObject(o T, state int) *poolObject[T] {
+    now := time.Now()
+    return &poolObject[T]{
+        when:    now,
+        state:   state,
+        obj:     o,
+        created: now,
+        expire:  objutil.Expiry(now, p.MaxLifetime, p.MaxLifetimeJitter),
     }
-    if p.init {
-        return
+}
+
+func (po *poolObject[T]) info() *gomem.PooledObjectInfo {
+    return &gomem.PooledObjectInfo{
+        CreateTime:     po.created,
+        LastBorrowTime: po.lastBorrow,
+        LastReturnTime: po.lastReturn,
+        BorrowCount:    po.borrowCount,
+    }
+}
+
+const defaultMaxSize = 32
+
+type borrowResult[T any] struct {
+    obj T
+    err error
+    po  *poolObject[T]
+}
+
+//根据cfg中的配置创建并初始化CommonPool，配置不合法时返回gomem.ErrInvalidConfig。
+//对象池使用cfg配置的副本，创建后修改cfg不会影响对象池；返回的对象池的配置项同样不能再修改
+func NewTypedCommonPool[T any](cfg *TypedCommonPool[T]) (*TypedCommonPool[T], error) {
+    p := &TypedCommonPool[T]{}
+    objutil.CopyExported(p, cfg)
+    if err := p.lazyInit(); err != nil {
+        return nil, err
     }
-    p.init = true
+    return p, nil
+}
+
+func NewCommonPool(cfg *CommonPool) (*CommonPool, error) {
+    return NewTypedCommonPool(cfg)
+}
+
+//只初始化一次，返回配置错误。所有公开方法在使用内部channel前调用，未调用Init的对象池将自动初始化
+func (p *TypedCommonPool[T]) lazyInit() error {
+    p.initOnce.Do(func() {
+        if p.initErr = p.validate(); p.initErr == nil {
+            p.initDefault()
+            go p.loop()
+        }
+    })
+    return p.initErr
+}
+
+func (p *TypedCommonPool[T]) validate() error {
+    if p.Factory == nil && p.FallibleFactory == nil {
+        return fmt.Errorf("%w: Factory is Empty", gomem.ErrInvalidConfig)
+    }
+    if p.MaxSize < 0 || p.MinIdle < 0 {
+        return fmt.Errorf("%w: MaxSize and MinIdle must not be negative", gomem.ErrInvalidConfig)
+    }
+    if p.MaxConcurrentCreates < 0 || p.CreateRetries < 0 || p.BreakerThreshold < 0 {
+        return fmt.Errorf("%w: MaxConcurrentCreates, CreateRetries and BreakerThreshold must not be negative", gomem.ErrInvalidConfig)
+    }
+    //MaxSize为0时使用默认值，按生效的MaxSize检查
+    maxSize := p.MaxSize
+    if maxSize == 0 {
+        maxSize = defaultMaxSize
+    }
+    if p.ReservedCapacity < 0 || p.ReservedCapacity > maxSize {
+        return fmt.Errorf("%w: ReservedCapacity must not exceed MaxSize", gomem.ErrInvalidConfig)
+    }
+    return nil
+}
+
+func (p *TypedCommonPool[T]) initDefault() {
+    if p.FallibleFactory != nil {
+        p.factory = p.FallibleFactory
+    } else {
+        p.factory = fallibleFactory[T]{p.Factory}
+    }
+    f := statsFactory[T]{TypedFallibleObjectFactory: p.factory, stats: &p.stats, events: &p.events}
+    if p.Strict {
+        f.strict = &p.strict
+    }
+    p.factory = f
     if p.MinIdle == 0 {
         p.MinIdle = 8
     }
     if p.MaxSize == 0 {
-        p.MaxSize = 32
+        p.MaxSize = defaultMaxSize
     }
+    //最初的版本在此误将MaxSize设为-1，导致未设置MaxWaitMillis的对象池无法创建对象
     if p.MaxWaitMillis == 0 {
-        p.MaxSize = -1
+        p.MaxWaitMillis = -1
     }
     if p.MinEvictableIdleTimeMillis == 0 {
         p.MinEvictableIdleTimeMillis = 30 * time.Minute
     }
+    if p.SoftMinEvictableIdleTimeMillis == 0 {
+        p.SoftMinEvictableIdleTimeMillis = -1
+    }
+    if p.EvictionPolicy == nil {
+        p.EvictionPolicy = gomem.DefaultEvictionPolicy{}
+    }
     if p.TimeBetweenEvictionRunsMillis == 0 {
         p.TimeBetweenEvictionRunsMillis = -1
     }
     if p.NumTestsPerEvictionRun == 0 {
         p.NumTestsPerEvictionRun = 3
     }
+    if p.RemoveAbandonedTimeout == 0 {
+        p.RemoveAbandonedTimeout = 5 * time.Minute
+    }
+    if p.CreateRetryBackoff == 0 {
+        p.CreateRetryBackoff = 100 * time.Millisecond
+    }
+    if p.CreateRetryMaxBackoff == 0 {
+        p.CreateRetryMaxBackoff = 10 * time.Second
+    }
+    if p.BreakerCooldown == 0 {
+        p.BreakerCooldown = 5 * time.Second
+    }
 
-    p.getChan = make(chan interface{})
-    p.putChan = make(chan interface{})
+    p.getChan = make(chan T)
+    p.borrowChan = make(chan borrowResult[T])
+    p.tryChan = make(chan chan borrowResult[T])
+    p.putChan = make(chan T)
+    p.abandonChan = make(chan bool)
+    p.cmdChan = make(chan func())
+    p.waitChan = make(chan *waiter[T])
+    p.createdChan = make(chan created[T])
     p.stop = make(chan bool)
+    p.closing = make(chan bool)
+    p.drained = make(chan bool)
 
+    p.queue = list.New()
+    p.waitQueue = list.New()
+    p.waitTimer = time.NewTimer(time.Hour)
+    p.waitTimer.Stop()
+    p.retryTimer = time.NewTimer(time.Hour)
+    p.retryTimer.Stop()
+    p.active = map[interface{}][]*poolObject[T]{}
+    p.abandoned = map[interface{}]int{}
     p.curCount = 0
 }
 
-//支持获取channel，但对factory的支持以及获取超时时间的配置项失效；支持回收channel，但对factory的支持失效，不建议使用
-func (p *CommonPool) Init() (<-chan interface{}, chan<- interface{}) {
-    p.initDefault()
-    go func() {
-        queue := list.New()
-        var timer *time.Timer
-        if p.TimeBetweenEvictionRunsMillis == -1 {
-            timer = &time.Timer{C: make(chan time.Time)}
+//支持获取channel，但获取超时时间的配置项失效，且无法获知创建、验证失败等错误；支持回收channel，不建议使用。
+//可重复、并发调用，只初始化一次；配置不合法时panic
+func (p *TypedCommonPool[T]) Init() (<-chan T, chan<- T) {
+    if err := p.lazyInit(); err != nil {
+        panic(err)
+    }
+    return p.getChan, p.putChan
+}
+
+//内部协程
+func (p *TypedCommonPool[T]) loop() {
+    var timer *time.Timer
+    if p.TimeBetweenEvictionRunsMillis == -1 {
+        timer = &time.Timer{C: make(chan time.Time)}
+    } else {
+        timer = time.NewTimer(p.TimeBetweenEvictionRunsMillis)
+    }
+
+    for {
+        //fmt.Println("main loop")
+        var e *list.Element
+        if p.shuttingDown {
+            p.checkDrained()
         } else {
-            timer = time.NewTimer(p.TimeBetweenEvictionRunsMillis)
+            //排队的等待者优先获取对象
+            e = p.serveWaiters(p.prepare())
+            if e != nil && !p.allowed(0) {
+                //剩余对象为高优先级借用者保留
+                e = nil
+            }
         }
 
-        for {
-            //fmt.Println("main loop")
-            if queue.Len() == 0 {
-                o := p.make()
-                //到达对象池上限
-                if o == nil {
-                    //等待用户归还对象
-                    got := false
-                    for !got {
-                        select {
-                        case <-p.stop:
-                            return
-                        case b := <-p.putChan:
-                            if p.idleObj(b) {
-                                queue.PushBack(&poolObject{time.Now(), IDLE, b})
-                                got = true
-                            }
-                        case <-timer.C:
-                            //fmt.Println("in sub loop")
-                            e := queue.Front()
-                            next := e
-                            for e != nil && queue.Len() > p.MinIdle {
-                                next = e.Next()
-                                if p.MinEvictableIdleTimeMillis > 0 && time.Since(e.Value.(*poolObject).when) > p.MinEvictableIdleTimeMillis {
-                                    queue.Remove(e)
-                                    p.destoryObj(e.Value.(*poolObject).obj)
-                                    e.Value = nil
-                                }
-                                e = next
-                            }
-                            timer = time.NewTimer(p.TimeBetweenEvictionRunsMillis)
-                        }
-                    }
-                } else {
-                    queue.PushBack(&poolObject{time.Now(), ALLOCATED, o})
-                }
+        //没有可用对象时两个channel均为nil，只等待用户归还对象、定时回收或失败信息被取走
+        var getChan chan T
+        var borrowChan chan borrowResult[T]
+        var ret borrowResult[T]
+        //等待借出期间队首对象可能过期，到期时重新检查
+        var expireTimer *time.Timer
+        var expire <-chan time.Time
+        if e != nil {
+            ret.po = e.Value.(*poolObject[T])
+            ret.obj = ret.po.obj
+            getChan = p.getChan
+            borrowChan = p.borrowChan
+            if !ret.po.expire.IsZero() {
+                expireTimer = time.NewTimer(time.Until(ret.po.expire))
+                expire = expireTimer.C
             }
-            e := queue.Front()
-            po := e.Value.(*poolObject)
-            if po.state == IDLE || po.state == ALLOCATED {
-                p.Factory.ActivateObject(po.obj)
-                po.state = READY
+        } else if p.pendingErr != nil {
+            ret.err = p.pendingErr
+            borrowChan = p.borrowChan
+        }
+
+        select {
+        case <-p.stop:
+            return
+        case b := <-p.putChan:
+            p.giveBack(b)
+        case getChan <- ret.obj:
+            p.lend(e)
+        case borrowChan <- ret:
+            if e != nil {
+                p.lend(e)
+            } else {
+                p.pendingErr = nil
             }
-            select {
-            case <-p.stop:
-                return
-            case b := <-p.putChan:
-                if p.idleObj(b) {
-                    queue.PushBack(&poolObject{time.Now(), IDLE, b})
-                }
-            case p.getChan <- e.Value.(*poolObject).obj:
-                queue.Remove(e)
-            case <-timer.C:
-                e := queue.Front()
-                next := e
-                for e != nil && queue.Len() > p.MinIdle {
-                    next = e.Next()
-                    if p.MinEvictableIdleTimeMillis > 0 && time.Since(e.Value.(*poolObject).when) > p.MinEvictableIdleTimeMillis {
-                        queue.Remove(e)
-                        p.destoryObj(e.Value.(*poolObject).obj)
-                        e.Value = nil
-                    }
-                    e = next
+        case reply := <-p.tryChan:
+            if e != nil {
+                p.lend(e)
+            } else if p.pendingErr != nil {
+                p.pendingErr = nil
+            } else if p.shuttingDown {
+                ret.err = gomem.ErrClosed
+            } else if p.creating > 0 && p.allowed(0) {
+                //未达到MaxSize，只是对象仍在后台创建，排队等待创建完成（最多MaxWaitMillis）而不是返回ErrExhausted
+                w := &waiter[T]{reply: reply}
+                if p.MaxWaitMillis > 0 {
+                    w.deadline = time.Now().Add(p.MaxWaitMillis)
                 }
-                timer = time.NewTimer(p.TimeBetweenEvictionRunsMillis)
+                p.enqueueWaiter(w)
+                break
+            } else {
+                ret.err = gomem.ErrExhausted
+            }
+            reply <- ret
+        case cmd := <-p.cmdChan:
+            cmd()
+        case w := <-p.waitChan:
+            p.enqueueWaiter(w)
+        case r := <-p.createdChan:
+            p.onCreated(r)
+        case <-p.retryTimer.C:
+            p.retryCreate()
+        case <-p.waitTimer.C:
+            p.expireWaiters()
+        case <-expire:
+            //队首对象已过期，下一轮由ready销毁
+        case <-p.abandonChan:
+            if p.queue.Len() < 2 && p.curCount-p.queue.Len() > p.MaxSize-3 {
+                p.removeAbandoned()
+            }
+        case <-timer.C:
+            p.evict()
+            if p.RemoveAbandonedOnMaintenance {
+                p.removeAbandoned()
+            }
+            if !p.shuttingDown {
+                p.ensureMinIdle()
             }
+            timer = time.NewTimer(p.TimeBetweenEvictionRunsMillis)
+        }
+        if expireTimer != nil {
+            expireTimer.Stop()
         }
-    }()
+    }
+}
 
-    return p.getChan, p.putChan
+//立即关闭对象池并销毁所有空闲对象，不等待借出的对象归还，相当于使用已结束的ctx调用Shutdown
+func (p *TypedCommonPool[T]) Close() {
+    ctx, cancel := context.WithCancel(context.Background())
+    cancel()
+    p.Shutdown(ctx)
 }
 
-func (p *CommonPool) Close() {
+//关闭对象池：新的借用者及正在等待的借用者获得gomem.ErrClosed，销毁所有空闲对象，
+//等待借出的对象归还并逐个销毁，直到全部归还或ctx结束。返回ctx结束时仍未归还的对象数量及ctx的错误，
+//重复调用时返回gomem.ErrClosed。Init返回的获取channel在关闭后不再有对象，关闭后归还的对象将被直接销毁
+func (p *TypedCommonPool[T]) Shutdown(ctx context.Context) (int, error) {
+    if err := p.lazyInit(); err != nil {
+        return 0, err
+    }
+    if !atomic.CompareAndSwapInt32(&p.closed, 0, 1) {
+        return 0, gomem.ErrClosed
+    }
+    close(p.closing)
+    p.exec(p.beginShutdown)
+
+    var err error
+    select {
+    case <-p.drained:
+    case <-ctx.Done():
+        err = ctx.Err()
+    }
+    n := 0
+    p.exec(func() {
+        n = p.curCount - p.queue.Len()
+    })
     close(p.stop)
+    p.events.Close()
+    if n == 0 {
+        return 0, nil
+    }
+    return n, err
 }
 
-func (p *CommonPool) syncMake() interface{} {
-    if p.curCount < p.MaxSize {
-        o := p.Factory.MakeObject()
-        p.curCount++
-        return o
+//只能由内部协程调用
+func (p *TypedCommonPool[T]) beginShutdown() {
+    p.shuttingDown = true
+    p.pendingErr = nil
+    for p.queue.Len() > 0 {
+        po := p.queue.Remove(p.queue.Front()).(*poolObject[T])
+        po.state = INVALID
+        p.destoryObj(po.obj)
     }
-    return nil
+    p.evictNext = nil
+    for p.waitQueue.Len() > 0 {
+        w := p.waitQueue.Remove(p.waitQueue.Front()).(*waiter[T])
+        if w.serve() {
+            w.reply <- borrowResult[T]{err: gomem.ErrClosed}
+        }
+    }
+    p.checkDrained()
 }
 
-func (p *CommonPool) idleObj(i interface{}) bool {
-    if i == nil {
-        return false
+//借出的对象全部归还后通知Shutdown。只能由内部协程调用
+func (p *TypedCommonPool[T]) checkDrained() {
+    if !p.drainedClosed && p.curCount-p.queue.Len() <= 0 {
+        p.drainedClosed = true
+        close(p.drained)
     }
+}
+
+//没有空闲对象时创建一个（MaxConcurrentCreates大于0时按等待者数量在后台创建），返回队首可以交给用户的对象。
+//只能由内部协程调用
+func (p *TypedCommonPool[T]) prepare() *list.Element {
+    for {
+        if p.queue.Len() == 0 && p.pendingErr == nil && p.MaxConcurrentCreates > 0 {
+            want := p.waitQueue.Len()
+            if want < 1 {
+                want = 1
+            }
+            p.startCreates(want)
+        } else if p.queue.Len() == 0 && p.pendingErr == nil && p.creatable() {
+            o, ok, err := p.make()
+            if err != nil {
+                if !p.recordCreate(err) {
+                    p.pendingErr = err
+                }
+            } else if ok {
+                p.recordCreate(nil)
+                p.queue.PushBack(p.newPoolObject(o, ALLOCATED))
+            }
+        }
+        count := p.curCount
+        e, err := p.ready()
+        if err != nil {
+            p.pendingErr = err
+        }
+        if e == nil && err == nil && p.queue.Len() == 0 && p.curCount < count {
+            //空闲对象均已过期或失效并被销毁，释放的名额可以立即用于创建新对象
+            continue
+        }
+        if e != nil {
+            //已有可用对象，之前的失败信息不再需要通知用户
+            p.pendingErr = nil
+        } else if p.pendingErr == nil && p.failFast() {
+            p.pendingErr = gomem.ErrCircuitOpen
+        }
+        return e
+    }
+}
 
-    if p.TestWhileIdle {
-        if !p.Factory.ValidateObject(i) {
-            return false
+//返回队首可以交给用户的对象。过期、激活或验证失败的对象将被销毁，空闲对象失败时继续尝试下一个，
+//新创建的对象失败时返回ErrFactory或ErrValidationFailed
+func (p *TypedCommonPool[T]) ready() (*list.Element, error) {
+    for e := p.queue.Front(); e != nil; e = p.queue.Front() {
+        po := e.Value.(*poolObject[T])
+        if objutil.Expired(po.expire) {
+            p.stats.Evicted.Add(1)
+            p.events.Emit(gomem.EventEvict, po.obj, po.state, time.Since(po.when))
+            p.invalidateIdle(e)
+            continue
         }
+        if po.state == READY {
+            return e, nil
+        }
+        if err := p.factory.ActivateObject(po.obj); err != nil {
+            p.events.Emit(gomem.EventInvalidate, po.obj, po.state, 0)
+            p.queue.Remove(e)
+            p.destoryObj(po.obj)
+            if po.state == ALLOCATED {
+                return nil, factoryError(err)
+            }
+            continue
+        }
+        p.events.Emit(gomem.EventActivate, po.obj, po.state, 0)
+        if p.TestOnBorrow {
+            if !p.factory.ValidateObject(po.obj) {
+                p.events.Emit(gomem.EventInvalidate, po.obj, po.state, 0)
+                p.queue.Remove(e)
+                p.destoryObj(po.obj)
+                if po.state == ALLOCATED {
+                    return nil, gomem.ErrValidationFailed
+                }
+                //空闲对象验证失败，继续尝试下一个
+                continue
+            }
+        }
+        po.state = READY
+        return e, nil
     }
-    p.Factory.PassivateObject(i)
-    return true
+    return nil, nil
 }
 
-func (p *CommonPool) destoryObj(i interface{}) {
-    if i != nil {
-        p.Factory.DestroyObject(i)
+//返回false, nil表示已达到MaxSize；创建失败时不占用curCount
+func (p *TypedCommonPool[T]) syncMake() (T, bool, error) {
+    var o T
+    if !p.full() {
+        var err error
+        o, err = p.factory.MakeObject()
+        if err != nil {
+            return o, false, factoryError(err)
+        }
+        if objutil.IsNil(o) {
+            return o, false, gomem.ErrFactory
+        }
+        p.curCount++
+        return o, true, nil
     }
+    return o, false, nil
 }
 
-func (p *CommonPool) make() interface{} {
-    i := p.syncMake()
-    if i != nil {
-        if p.TestOnCreate {
-            if !p.Factory.ValidateObject(i) {
-                return nil
-            }
+//对象被回收，验证或钝化失败的对象将被销毁
+func (p *TypedCommonPool[T]) idleObj(po *poolObject[T]) {
+    if p.TestOnReturn {
+        if !p.factory.ValidateObject(po.obj) {
+            p.events.Emit(gomem.EventInvalidate, po.obj, po.state, 0)
+            p.destoryObj(po.obj)
+            return
         }
     }
-    return i
+    if err := p.factory.PassivateObject(po.obj); err != nil {
+        p.events.Emit(gomem.EventInvalidate, po.obj, po.state, 0)
+        p.destoryObj(po.obj)
+        return
+    }
+    po.when = time.Now()
+    po.state = IDLE
+    po.stack.Store(nil)
+    if !p.Lifo {
+        p.queue.PushBack(po)
+        return
+    }
+    //队首已激活等待借出的对象重新钝化，让出队首位置
+    if f := p.queue.Front(); f != nil && f.Value.(*poolObject[T]).state == READY {
+        ready := f.Value.(*poolObject[T])
+        if err := p.factory.PassivateObject(ready.obj); err != nil {
+            p.invalidateIdle(f)
+        } else {
+            ready.state = IDLE
+        }
+    }
+    p.queue.PushFront(po)
 }
 
-func (p *CommonPool) Get() interface{} {
-    var ret interface{}
-    if !p.BlockWhenExhausted {
-        select {
-        case ret = <-p.getChan:
-            if p.TestOnBorrow {
-                if !p.Factory.ValidateObject(ret) {
-                    return nil
-                }
+//将队首对象借出，并记录到借出列表
+func (p *TypedCommonPool[T]) lend(e *list.Element) {
+    po := p.queue.Remove(e).(*poolObject[T])
+    po.state = ALLOCATED
+    po.lastBorrow = time.Now()
+    po.borrowCount++
+    key := objutil.Key(po.obj)
+    p.active[key] = append(p.active[key], po)
+    p.stats.Borrowed.Add(1)
+}
+
+//用户归还对象，不是由对象池借出（或已被当作遗弃对象销毁）的对象根据AcceptExternalObj处理
+func (p *TypedCommonPool[T]) giveBack(i T) {
+    if objutil.IsNil(i) {
+        return
+    }
+    p.stats.Returned.Add(1)
+    key := objutil.Key(i)
+    index := len(p.active[key]) - 1
+    if index < 0 && p.abandoned[key] > 0 {
+        p.forgetAbandoned(key)
+        return
+    }
+    if index < 0 && !p.AcceptExternalObj && !p.Strict {
+        //借出后被修改的值类型对象、append后重新分配的切片等无法按标识找到，视为最早借出且未归还的对象
+        key, index = p.oldestActive()
+    }
+    if index >= 0 {
+        po := p.active[key][index]
+        p.removeActive(key, index)
+        //同一标识下的记录只用于统计信息，回收的始终是用户归还的对象
+        po.obj = i
+        po.lastReturn = time.Now()
+        p.stats.ActiveTime.Observe(po.lastReturn.Sub(po.lastBorrow))
+        p.events.Emit(gomem.EventReturn, po.obj, po.state, po.lastReturn.Sub(po.lastBorrow))
+        if p.shuttingDown || objutil.Expired(po.expire) {
+            if !p.shuttingDown {
+                p.stats.Evicted.Add(1)
+                p.events.Emit(gomem.EventEvict, po.obj, po.state, 0)
             }
-            return ret
-        default:
-            return nil
+            po.state = INVALID
+            p.destoryObj(po.obj)
+            return
         }
+        p.idleObj(po)
+        return
+    }
+    if !p.AcceptExternalObj {
+        return
     }
+    if !p.shuttingDown && !p.full() {
+        p.curCount++
+        p.idleObj(p.newPoolObject(i, IDLE))
+    } else {
+        p.factory.DestroyObject(i)
+    }
+}
 
-    if p.MaxWaitMillis == -1 {
-        ret := <-p.getChan
-        if p.TestOnBorrow {
-            if !p.Factory.ValidateObject(ret) {
-                return nil
+//返回最早借出且未归还的对象在借出列表中的位置，没有借出的对象时index为-1
+func (p *TypedCommonPool[T]) oldestActive() (key interface{}, index int) {
+    index = -1
+    var oldest *poolObject[T]
+    for k, pos := range p.active {
+        for n, po := range pos {
+            if oldest == nil || po.lastBorrow.Before(oldest.lastBorrow) {
+                oldest, key, index = po, k, n
             }
         }
-        return ret
     }
+    return key, index
+}
 
-    select {
-    case ret = <-p.getChan:
-        if p.TestOnBorrow {
-            if !p.Factory.ValidateObject(ret) {
-                return nil
+func (p *TypedCommonPool[T]) removeActive(key interface{}, index int) {
+    pos := p.active[key]
+    if len(pos) == 1 {
+        delete(p.active, key)
+        return
+    }
+    pos[index] = pos[len(pos)-1]
+    pos[len(pos)-1] = nil
+    p.active[key] = pos[:len(pos)-1]
+}
+
+//销毁对象并释放其占用的curCount
+func (p *TypedCommonPool[T]) destoryObj(i T) {
+    if !objutil.IsNil(i) {
+        p.factory.DestroyObject(i)
+        p.curCount--
+    }
+}
+
+func (p *TypedCommonPool[T]) make() (T, bool, error) {
+    i, ok, err := p.syncMake()
+    if ok {
+        if p.TestOnCreate {
+            if !p.factory.ValidateObject(i) {
+                p.destoryObj(i)
+                return i, false, gomem.ErrValidationFailed
             }
         }
-        return ret
-    case <-time.After(p.MaxWaitMillis):
-        break
     }
+    return i, ok, err
+}
 
+//失败时返回T的零值
+func (p *TypedCommonPool[T]) Get() T {
+    ret, _ := p.Borrow()
     return ret
 }
 
-func (p *CommonPool) Put(i interface{}) {
-    if p.TestOnReturn {
-        if !p.Factory.ValidateObject(i) {
-            return
+//BlockWhenExhausted为false时，没有可用对象立即返回ErrExhausted（对象正在后台创建时等待创建完成，最多MaxWaitMillis）；
+//否则等待MaxWaitMillis，超时返回ErrTimeout
+func (p *TypedCommonPool[T]) Borrow() (T, error) {
+    start := time.Now()
+    o, err := p.borrow()
+    p.recordBorrow(start, o, err)
+    return o, err
+}
+
+func (p *TypedCommonPool[T]) borrow() (T, error) {
+    if err := p.lazyInit(); err != nil {
+        var zero T
+        return zero, err
+    }
+    if !p.BlockWhenExhausted {
+        //由内部协程判断是否有可用对象
+        p.checkAbandoned()
+        reply := make(chan borrowResult[T], 1)
+        select {
+        case p.tryChan <- reply:
+            ret := <-reply
+            return p.borrowed(ret)
+        case <-p.closing:
+            var zero T
+            return zero, gomem.ErrClosed
         }
     }
-    p.putChan <- i
+
+    p.checkAbandoned()
+    if p.Fairness || p.MaxConcurrentCreates > 0 {
+        var deadline time.Time
+        if p.MaxWaitMillis > 0 {
+            deadline = time.Now().Add(p.MaxWaitMillis)
+        }
+        atomic.AddInt32(&p.waiters, 1)
+        defer atomic.AddInt32(&p.waiters, -1)
+        return p.waitFair(context.Background(), deadline, 0)
+    }
+    var timeout <-chan time.Time
+    if p.MaxWaitMillis > 0 {
+        timer := time.NewTimer(p.MaxWaitMillis)
+        defer timer.Stop()
+        timeout = timer.C
+    }
+
+    atomic.AddInt32(&p.waiters, 1)
+    defer atomic.AddInt32(&p.waiters, -1)
+    var zero T
+    select {
+    case ret := <-p.borrowChan:
+        return p.borrowed(ret)
+    case <-p.closing:
+        return zero, gomem.ErrClosed
+    case <-timeout:
+        return zero, gomem.ErrTimeout
+    }
 }
 
-type DummyFactory func() interface{}
+//与Get相同，但等待时间由ctx控制，MaxWaitMillis及BlockWhenExhausted对此方法无效
+//borrowChan为无缓存channel，ctx结束时对象不会被交出，因此放弃等待不会造成对象泄漏
+func (p *TypedCommonPool[T]) GetContext(ctx context.Context) (T, error) {
+    start := time.Now()
+    o, err := p.getContext(ctx)
+    p.recordBorrow(start, o, err)
+    return o, err
+}
 
-func (f *DummyFactory) ActivateObject(interface{})      {}
-func (f *DummyFactory) DestroyObject(interface{})       {}
-func (f *DummyFactory) MakeObject() interface{}         { return (*f)() }
-func (f *DummyFactory) PassivateObject(interface{})     {}
-func (f *DummyFactory) ValidateObject(interface{}) bool { return true }
+func (p *TypedCommonPool[T]) getContext(ctx context.Context) (T, error) {
+    var zero T
+    if err := ctx.Err(); err != nil {
+        return zero, err
+    }
+    if err := p.lazyInit(); err != nil {
+        return zero, err
+    }
+    p.checkAbandoned()
+    atomic.AddInt32(&p.waiters, 1)
+    defer atomic.AddInt32(&p.waiters, -1)
+    if p.Fairness || p.MaxConcurrentCreates > 0 {
+        return p.waitFair(ctx, time.Time{}, 0)
+    }
+    select {
+    case ret := <-p.borrowChan:
+        return p.borrowed(ret)
+    case <-p.closing:
+        return zero, gomem.ErrClosed
+    case <-ctx.Done():
+        return zero, ctx.Err()
+    }
+}
+
+//与GetContext相同，但借用者总是排队等待，优先级高的先获得对象，同优先级按到达顺序。
+//不带优先级的借用者优先级为0，priority为负数时正在等待的Get、Borrow、GetContext借用者先获得对象
+func (p *TypedCommonPool[T]) GetWithPriority(ctx context.Context, priority int) (T, error) {
+    var zero T
+    if err := ctx.Err(); err != nil {
+        return zero, err
+    }
+    if err := p.lazyInit(); err != nil {
+        return zero, err
+    }
+    start := time.Now()
+    p.checkAbandoned()
+    atomic.AddInt32(&p.waiters, 1)
+    defer atomic.AddInt32(&p.waiters, -1)
+    o, err := p.waitFair(ctx, time.Time{}, priority)
+    p.recordBorrow(start, o, err)
+    return o, err
+}
 
-type DefaultFactory struct {
-    Activate  func(interface{})
-    Destroy   func(interface{})
-    Make      func() interface{}
-    Passivate func(interface{})
-    Validate  func(interface{}) bool
+//LogAbandoned为true时在借出对象的协程中记录调用栈
+func (p *TypedCommonPool[T]) borrowed(ret borrowResult[T]) (T, error) {
+    if p.LogAbandoned && ret.po != nil {
+        stack := debug.Stack()
+        ret.po.stack.Store(&stack)
+    }
+    return ret.obj, ret.err
 }
 
-func (f *DefaultFactory) ActivateObject(i interface{}) {
-    if f.Activate != nil {
-        f.Activate(i)
+//TestOnReturn为true时，验证失败的对象将被销毁；对象池关闭后归还的对象将被直接销毁
+func (p *TypedCommonPool[T]) Put(i T) {
+    if p.lazyInit() != nil {
+        return
+    }
+    if p.Strict && !objutil.IsNil(i) {
+        if err := p.strict.Return(i, p.AcceptExternalObj); err != nil {
+            panic(fmt.Errorf("commonPool2: put %T: %w", i, err))
+        }
+    }
+    if p.PoisonOnReturn {
+        strict.Poison(i)
+    }
+    select {
+    case p.putChan <- i:
+    case <-p.stop:
+        if !objutil.IsNil(i) {
+            p.stats.Returned.Add(1)
+            p.factory.DestroyObject(i)
+        }
     }
 }
-func (f *DefaultFactory) DestroyObject(i interface{}) {
-    if f.Destroy != nil {
-        f.Destroy(i)
+
+//销毁借出的对象而不是将其归还，并释放其占用的MaxSize名额。对象不是由对象池借出时返回ErrUnknownObject
+func (p *TypedCommonPool[T]) InvalidateObject(i T) error {
+    var err error
+    if cmdErr := p.exec(func() {
+        key := objutil.Key(i)
+        pos := p.active[key]
+        if len(pos) == 0 {
+            err = gomem.ErrUnknownObject
+            return
+        }
+        po := pos[len(pos)-1]
+        p.removeActive(key, len(pos)-1)
+        p.events.Emit(gomem.EventInvalidate, i, po.state, 0)
+        po.state = INVALID
+        p.destoryObj(i)
+    }); cmdErr != nil {
+        return cmdErr
     }
+    if err == nil && p.Strict {
+        p.strict.Return(i, true)
+        p.strict.Forget(i)
+    }
+    return err
 }
-func (f *DefaultFactory) MakeObject() interface{} {
-    if f.Make == nil {
-        panic("Make func is nil")
+
+//同步创建对象直到空闲对象达到MinIdle或对象数量达到MaxSize，返回第一个创建错误或ctx的错误。
+//每次只创建一个对象，预热期间不会阻塞其他借用者；MaxConcurrentCreates大于0时在调用者协程中创建。
+//需要异步预热时可在新的协程中调用
+func (p *TypedCommonPool[T]) Prewarm(ctx context.Context) error {
+    for {
+        if err := ctx.Err(); err != nil {
+            return err
+        }
+        done := false
+        var err error
+        if cmdErr := p.exec(func() {
+            if p.shuttingDown {
+                err = gomem.ErrClosed
+                return
+            }
+            if p.queue.Len()+p.creating >= p.MinIdle || p.full() {
+                done = true
+                return
+            }
+            if p.failFast() {
+                err = gomem.ErrCircuitOpen
+                return
+            }
+            if p.MaxConcurrentCreates > 0 {
+                p.creating++
+                return
+            }
+            var o T
+            var ok bool
+            o, ok, err = p.make()
+            if ok || err != nil {
+                p.recordCreate(err)
+            }
+            if ok {
+                p.idleObj(p.newPoolObject(o, IDLE))
+            }
+        }); cmdErr != nil {
+            return cmdErr
+        }
+        if !done && err == nil && p.MaxConcurrentCreates > 0 {
+            var o T
+            o, err = p.create()
+            if cmdErr := p.exec(func() {
+                p.creating--
+                p.recordCreate(err)
+                if err == nil && p.shuttingDown {
+                    p.factory.DestroyObject(o)
+                } else if err == nil {
+                    p.curCount++
+                    p.idleObj(p.newPoolObject(o, IDLE))
+                }
+            }); cmdErr != nil {
+                if err == nil {
+                    p.factory.DestroyObject(o)
+                }
+                return cmdErr
+            }
+        }
+        if err != nil {
+            return err
+        }
+        if done {
+            return nil
+        }
     }
-    return f.Make()
 }
-func (f *DefaultFactory) PassivateObject(i interface{}) {
-    if f.Passivate != nil {
-        f.Passivate(i)
+
+//创建一个对象并放入空闲队列，可用于预先加载对象。达到MaxSize时返回ErrExhausted
+func (p *TypedCommonPool[T]) AddObject() error {
+    var err error
+    if cmdErr := p.exec(func() {
+        if p.shuttingDown {
+            err = gomem.ErrClosed
+            return
+        }
+        if p.failFast() {
+            err = gomem.ErrCircuitOpen
+            return
+        }
+        o, ok, makeErr := p.make()
+        if makeErr != nil {
+            p.recordCreate(makeErr)
+            err = makeErr
+            return
+        }
+        if !ok {
+            err = gomem.ErrExhausted
+            return
+        }
+        p.recordCreate(nil)
+        p.idleObj(p.newPoolObject(o, IDLE))
+    }); cmdErr != nil {
+        return cmdErr
     }
+    return err
+}
+
+//销毁所有空闲对象
+func (p *TypedCommonPool[T]) Clear() error {
+    return p.exec(func() {
+        for p.queue.Len() > 0 {
+            p.destoryObj(p.queue.Remove(p.queue.Front()).(*poolObject[T]).obj)
+        }
+    })
 }
-func (f *DefaultFactory) ValidateObject(i interface{}) bool {
-    if f.Validate != nil {
-        return f.Validate(i)
+
+//空闲对象的数量，包含内部协程预先创建等待借出的对象
+func (p *TypedCommonPool[T]) NumIdle() int {
+    n := 0
+    p.exec(func() {
+        n = p.queue.Len()
+    })
+    return n
+}
+
+//已借出对象的数量
+func (p *TypedCommonPool[T]) NumActive() int {
+    n := 0
+    p.exec(func() {
+        n = p.curCount - p.queue.Len()
+    })
+    return n
+}
+
+//正在等待获取对象的用户数量
+func (p *TypedCommonPool[T]) NumWaiters() int {
+    return int(atomic.LoadInt32(&p.waiters))
+}
+
+//在内部协程中执行f并等待其完成，对象池关闭时返回ErrClosed
+func (p *TypedCommonPool[T]) exec(f func()) error {
+    if err := p.lazyInit(); err != nil {
+        return err
+    }
+    done := make(chan bool)
+    select {
+    case p.cmdChan <- func() { f(); close(done) }:
+        <-done
+        return nil
+    case <-p.stop:
+        return gomem.ErrClosed
     }
-    return true
 }
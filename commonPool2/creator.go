@@ -0,0 +1,89 @@
+/**
+ * Copyright (C) 2019, Xiongfa Li.
+ * All right reserved.
+ * @author xiongfa.li
+ * @date 2019/3/18
+ * @time 11:40
+ * @version V1.0
+ * Description: 
+ */
+
+package commonPool
+
+import (
+    "github.com/xfali/gomem"
+    "github.com/xfali/gomem/internal/objutil"
+)
+
+//创建协程的创建结果
+type created[T any] struct {
+    obj T
+    err error
+}
+
+//对象数量（含正在创建的对象）已达到MaxSize。只能由内部协程调用
+func (p *TypedCommonPool[T]) full() bool {
+    return p.curCount+p.creating >= p.MaxSize
+}
+
+//MaxConcurrentCreates大于0时，按排队的等待者数量（至少1个）启动创建协程，
+//正在创建的对象占用MaxSize名额，重试等待及熔断期间不创建。只能由内部协程调用
+func (p *TypedCommonPool[T]) startCreates(want int) {
+    for p.queue.Len()+p.creating < want && p.creating < p.MaxConcurrentCreates && !p.full() && p.creatable() {
+        p.creating++
+        go p.createAsync()
+    }
+}
+
+func (p *TypedCommonPool[T]) createAsync() {
+    o, err := p.create()
+    select {
+    case p.createdChan <- created[T]{obj: o, err: err}:
+    case <-p.stop:
+        if err == nil {
+            p.factory.DestroyObject(o)
+        }
+    }
+}
+
+//在调用者协程中创建对象，TestOnCreate为true时验证，验证失败的对象将被销毁
+func (p *TypedCommonPool[T]) create() (T, error) {
+    o, err := p.factory.MakeObject()
+    if err != nil {
+        return o, factoryError(err)
+    }
+    if objutil.IsNil(o) {
+        return o, gomem.ErrFactory
+    }
+    if p.TestOnCreate && !p.factory.ValidateObject(o) {
+        p.factory.DestroyObject(o)
+        return o, gomem.ErrValidationFailed
+    }
+    return o, nil
+}
+
+//创建完成的对象排在队首，交给最早的等待者；创建失败的错误交给下一个借用者。只能由内部协程调用
+func (p *TypedCommonPool[T]) onCreated(r created[T]) {
+    p.creating--
+    if p.shuttingDown {
+        if r.err == nil {
+            p.factory.DestroyObject(r.obj)
+        }
+        return
+    }
+    if r.err != nil {
+        if !p.recordCreate(r.err) && p.pendingErr == nil {
+            p.pendingErr = r.err
+        }
+        return
+    }
+    p.recordCreate(nil)
+    p.curCount++
+    po := p.newPoolObject(r.obj, ALLOCATED)
+    //队首已激活的对象即将被借出，放在其后
+    if f := p.queue.Front(); f != nil && f.Value.(*poolObject[T]).state == READY {
+        p.queue.InsertAfter(po, f)
+    } else {
+        p.queue.PushFront(po)
+    }
+}
@@ -0,0 +1,145 @@
+/**
+ * Copyright (C) 2019, Xiongfa Li.
+ * All right reserved.
+ * @author xiongfa.li
+ * @date 2019/3/1
+ * @time 10:20
+ * @version V1.0
+ * Description: 
+ */
+
+package commonPool
+
+import (
+    "container/list"
+    "github.com/xfali/gomem"
+    "github.com/xfali/gomem/internal/objutil"
+    "time"
+)
+
+//检查NumTestsPerEvictionRun个空闲对象，从上次结束的位置继续，到达队尾后从队首开始。
+//Lifo为true时最久未被使用的对象位于队尾，因此从队尾向队首检查。EvictionPolicy判断需要移除或TestWhileIdle验证失败的对象将被销毁。只能由内部协程调用
+func (p *TypedCommonPool[T]) evict() {
+    config := &gomem.EvictionConfig{
+        MinEvictableIdleTime:     p.MinEvictableIdleTimeMillis,
+        SoftMinEvictableIdleTime: p.SoftMinEvictableIdleTimeMillis,
+        MinIdle:                  p.MinIdle,
+    }
+    n := p.numTests()
+    e := p.evictNext
+    if e == nil || !p.inQueue(e) {
+        e = p.evictFirst()
+    }
+    for i := 0; i < n && e != nil; i++ {
+        next := p.evictFollow(e)
+        if next == nil {
+            next = p.evictFirst()
+        }
+        if !p.evictTest(config, e) {
+            if next == e {
+                next = nil
+            }
+        }
+        e = next
+    }
+    p.evictNext = e
+}
+
+//将空闲对象补充到MinIdle，创建失败时停止，等待下次执行。只能由内部协程调用
+func (p *TypedCommonPool[T]) ensureMinIdle() {
+    if p.MaxConcurrentCreates > 0 {
+        p.startCreates(p.MinIdle)
+        return
+    }
+    for p.queue.Len() < p.MinIdle && p.creatable() {
+        o, ok, err := p.make()
+        if err != nil {
+            p.recordCreate(err)
+            return
+        }
+        if !ok {
+            return
+        }
+        p.recordCreate(nil)
+        p.idleObj(p.newPoolObject(o, IDLE))
+    }
+}
+
+//第一个检查的空闲对象
+func (p *TypedCommonPool[T]) evictFirst() *list.Element {
+    if p.Lifo {
+        return p.queue.Back()
+    }
+    return p.queue.Front()
+}
+
+//e之后检查的空闲对象
+func (p *TypedCommonPool[T]) evictFollow(e *list.Element) *list.Element {
+    if p.Lifo {
+        return e.Prev()
+    }
+    return e.Next()
+}
+
+//返回false表示对象已被销毁
+func (p *TypedCommonPool[T]) evictTest(config *gomem.EvictionConfig, e *list.Element) bool {
+    po := e.Value.(*poolObject[T])
+    state := po.state
+    po.state = EVICTION
+    if objutil.Expired(po.expire) || p.EvictionPolicy.Evict(config, po.info(), p.queue.Len()) {
+        p.stats.Evicted.Add(1)
+        p.events.Emit(gomem.EventEvict, po.obj, state, time.Since(po.when))
+        p.invalidateIdle(e)
+        return false
+    }
+
+    if p.TestWhileIdle {
+        po.state = VALIDATION
+        //READY状态的对象已被激活，其余对象验证前需要激活，验证后重新钝化
+        if state == IDLE {
+            if err := p.factory.ActivateObject(po.obj); err != nil {
+                p.events.Emit(gomem.EventInvalidate, po.obj, po.state, 0)
+                p.invalidateIdle(e)
+                return false
+            }
+        }
+        if !p.factory.ValidateObject(po.obj) {
+            p.events.Emit(gomem.EventInvalidate, po.obj, po.state, 0)
+            p.invalidateIdle(e)
+            return false
+        }
+        if state == IDLE {
+            if err := p.factory.PassivateObject(po.obj); err != nil {
+                p.events.Emit(gomem.EventInvalidate, po.obj, po.state, 0)
+                p.invalidateIdle(e)
+                return false
+            }
+        }
+    }
+    po.state = state
+    return true
+}
+
+func (p *TypedCommonPool[T]) invalidateIdle(e *list.Element) {
+    po := p.queue.Remove(e).(*poolObject[T])
+    po.state = INVALID
+    p.destoryObj(po.obj)
+}
+
+//本次需要检查的空闲对象数量
+func (p *TypedCommonPool[T]) numTests() int {
+    idle := p.queue.Len()
+    if p.NumTestsPerEvictionRun >= 0 {
+        if p.NumTestsPerEvictionRun < idle {
+            return p.NumTestsPerEvictionRun
+        }
+        return idle
+    }
+    n := -p.NumTestsPerEvictionRun
+    return (idle + n - 1) / n
+}
+
+//元素被移出队列后Next、Prev均返回nil，借此判断上次的检查位置是否仍在队列中
+func (p *TypedCommonPool[T]) inQueue(e *list.Element) bool {
+    return e.Next() != nil || e.Prev() != nil || p.queue.Front() == e
+}
@@ -0,0 +1,193 @@
+/**
+ * Copyright (C) 2019, Xiongfa Li.
+ * All right reserved.
+ * @author xiongfa.li
+ * @date 2019/2/26
+ * @time 14:20
+ * @version V1.0
+ * Description: 
+ */
+
+package commonPool
+
+import (
+    "errors"
+    "fmt"
+    "github.com/xfali/gomem"
+)
+
+//对象类型为interface{}的对象工厂
+type PooledObjectFactory = TypedPooledObjectFactory[interface{}]
+
+//类型安全的对象工厂，T为池中对象的类型
+type TypedPooledObjectFactory[T any] interface {
+    //对象被激活时调用
+    ActivateObject(T)
+    //对象处于idle状态，被定时释放时调用
+    DestroyObject(T)
+    //创建对象时调用
+    MakeObject() T
+    //对象回收之后进入idle状态时被调用
+    PassivateObject(T)
+    //验证对象是否有效
+    ValidateObject(T) bool
+}
+
+//对象类型为interface{}的可返回错误的对象工厂
+type FallibleObjectFactory = TypedFallibleObjectFactory[interface{}]
+
+//可返回错误的对象工厂，适用于打开连接、文件等可能失败的场景
+type TypedFallibleObjectFactory[T any] interface {
+    //对象被激活时调用，返回错误时对象将被销毁，对象池会尝试下一个对象
+    ActivateObject(T) error
+    //对象处于idle状态，被定时释放时调用
+    DestroyObject(T)
+    //创建对象时调用，返回错误时不占用MaxSize的名额，错误将返回给获取对象的用户
+    MakeObject() (T, error)
+    //对象回收之后进入idle状态时被调用，返回错误时对象将被销毁
+    PassivateObject(T) error
+    //验证对象是否有效
+    ValidateObject(T) bool
+}
+
+//key与对象类型均为interface{}的KeyedPooledObjectFactory
+type KeyedPooledObjectFactory = TypedKeyedPooledObjectFactory[interface{}, interface{}]
+
+//KeyedCommonPool使用的对象工厂，各方法与FallibleObjectFactory相同，但会收到对象所属的key
+type TypedKeyedPooledObjectFactory[K comparable, T any] interface {
+    //对象被激活时调用，返回错误时对象将被销毁，对象池会尝试下一个对象
+    ActivateObject(K, T) error
+    //对象被销毁时调用
+    DestroyObject(K, T)
+    //创建对象时调用，返回错误时不占用MaxSizePerKey及MaxTotal的名额，错误将返回给获取对象的用户
+    MakeObject(K) (T, error)
+    //对象回收之后进入idle状态时被调用，返回错误时对象将被销毁
+    PassivateObject(K, T) error
+    //验证对象是否有效
+    ValidateObject(K, T) bool
+}
+
+//对象类型为interface{}的DummyFactory
+type DummyFactory = TypedDummyFactory[interface{}]
+
+//只提供创建函数的对象工厂
+type TypedDummyFactory[T any] func() T
+
+func (f *TypedDummyFactory[T]) ActivateObject(T)      {}
+func (f *TypedDummyFactory[T]) DestroyObject(T)       {}
+func (f *TypedDummyFactory[T]) MakeObject() T         { return (*f)() }
+func (f *TypedDummyFactory[T]) PassivateObject(T)     {}
+func (f *TypedDummyFactory[T]) ValidateObject(T) bool { return true }
+
+//对象类型为interface{}的DefaultFactory
+type DefaultFactory = TypedDefaultFactory[interface{}]
+
+//由函数组成的对象工厂，除Make外均可为nil
+type TypedDefaultFactory[T any] struct {
+    Activate  func(T)
+    Destroy   func(T)
+    Make      func() T
+    Passivate func(T)
+    Validate  func(T) bool
+}
+
+func (f *TypedDefaultFactory[T]) ActivateObject(i T) {
+    if f.Activate != nil {
+        f.Activate(i)
+    }
+}
+func (f *TypedDefaultFactory[T]) DestroyObject(i T) {
+    if f.Destroy != nil {
+        f.Destroy(i)
+    }
+}
+func (f *TypedDefaultFactory[T]) MakeObject() T {
+    if f.Make == nil {
+        panic("Make func is nil")
+    }
+    return f.Make()
+}
+func (f *TypedDefaultFactory[T]) PassivateObject(i T) {
+    if f.Passivate != nil {
+        f.Passivate(i)
+    }
+}
+func (f *TypedDefaultFactory[T]) ValidateObject(i T) bool {
+    if f.Validate != nil {
+        return f.Validate(i)
+    }
+    return true
+}
+
+//key与对象类型均为interface{}的DefaultKeyedFactory
+type DefaultKeyedFactory = TypedDefaultKeyedFactory[interface{}, interface{}]
+
+//由函数组成的带key的对象工厂，除Make外均可为nil
+type TypedDefaultKeyedFactory[K comparable, T any] struct {
+    Activate  func(K, T) error
+    Destroy   func(K, T)
+    Make      func(K) (T, error)
+    Passivate func(K, T) error
+    Validate  func(K, T) bool
+}
+
+func (f *TypedDefaultKeyedFactory[K, T]) ActivateObject(key K, i T) error {
+    if f.Activate != nil {
+        return f.Activate(key, i)
+    }
+    return nil
+}
+func (f *TypedDefaultKeyedFactory[K, T]) DestroyObject(key K, i T) {
+    if f.Destroy != nil {
+        f.Destroy(key, i)
+    }
+}
+func (f *TypedDefaultKeyedFactory[K, T]) MakeObject(key K) (T, error) {
+    if f.Make == nil {
+        panic("Make func is nil")
+    }
+    return f.Make(key)
+}
+func (f *TypedDefaultKeyedFactory[K, T]) PassivateObject(key K, i T) error {
+    if f.Passivate != nil {
+        return f.Passivate(key, i)
+    }
+    return nil
+}
+func (f *TypedDefaultKeyedFactory[K, T]) ValidateObject(key K, i T) bool {
+    if f.Validate != nil {
+        return f.Validate(key, i)
+    }
+    return true
+}
+
+//将PooledObjectFactory适配为FallibleObjectFactory，MakeObject返回nil视为创建失败
+type fallibleFactory[T any] struct {
+    factory TypedPooledObjectFactory[T]
+}
+
+func (f fallibleFactory[T]) ActivateObject(i T) error {
+    f.factory.ActivateObject(i)
+    return nil
+}
+func (f fallibleFactory[T]) DestroyObject(i T) {
+    f.factory.DestroyObject(i)
+}
+func (f fallibleFactory[T]) MakeObject() (T, error) {
+    return f.factory.MakeObject(), nil
+}
+func (f fallibleFactory[T]) PassivateObject(i T) error {
+    f.factory.PassivateObject(i)
+    return nil
+}
+func (f fallibleFactory[T]) ValidateObject(i T) bool {
+    return f.factory.ValidateObject(i)
+}
+
+//使errors.Is(err, gomem.ErrFactory)成立，同时保留工厂返回的原始错误
+func factoryError(err error) error {
+    if errors.Is(err, gomem.ErrFactory) {
+        return err
+    }
+    return fmt.Errorf("%w: %w", gomem.ErrFactory, err)
+}
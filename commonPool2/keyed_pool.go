@@ -0,0 +1,613 @@
+/**
+ * Copyright (C) 2019, Xiongfa Li.
+ * All right reserved.
+ * @author xiongfa.li
+ * @date 2019/2/28
+ * @time 16:40
+ * @version V1.0
+ * Description: 
+ */
+
+package commonPool
+
+import (
+    "container/list"
+    "context"
+    "fmt"
+    "github.com/xfali/gomem"
+    "github.com/xfali/gomem/internal/objutil"
+    "github.com/xfali/gomem/internal/stats"
+    "github.com/xfali/gomem/internal/strict"
+    "sync"
+    "sync/atomic"
+    "time"
+)
+
+//key与对象类型均为interface{}的KeyedCommonPool
+type KeyedCommonPool = TypedKeyedCommonPool[interface{}, interface{}]
+
+//类似Apache KeyedObjectPool的带key对象池，每个key拥有独立的空闲对象及等待队列，所有key共享MaxTotal的上限
+//导出字段均为配置项，只能在Init或首次使用之前设置；之后由内部协程并发读取，修改属于数据竞争
+type TypedKeyedCommonPool[K comparable, T any] struct {
+    //每个key最小保留的idle对象的数量，默认0
+    MinIdlePerKey int
+    //每个key的最大对象数量,默认8
+    MaxSizePerKey int
+    //所有key的最大对象数量，达到上限时将销毁其他key中空闲最久的对象以创建新对象。-1 表示不限制；默认 -1
+    MaxTotal int
+    //获取资源的等待时间,BlockWhenExhausted 为 true 时有效。-1 代表无时间限制，一直阻塞直到有可用的资源
+    MaxWaitMillis time.Duration
+    //对象空闲的最小时间，达到此值后空闲对象将可能会被移除。-1 表示不移除；默认 30 分钟
+    MinEvictableIdleTimeMillis time.Duration
+    //创建对象时是否调用 Factory.ValidateObject 方法，默认 false
+    TestOnCreate bool
+    //获取对象时是否调用 Factory.ValidateObject 方法，默认 false
+    TestOnBorrow bool
+    //释放对象时是否调用 Factory.ValidateObject 方法，默认 false
+    TestOnReturn bool
+    //回收资源协程的执行周期，默认 -1 表示不定时回收
+    TimeBetweenEvictionRunsMillis time.Duration
+    //资源耗尽时，是否阻塞等待获取资源，默认 false
+    BlockWhenExhausted bool
+    //为true时跟踪key及对象标识，Put已归还的对象时panic(gomem.ErrDoubleReturn)，
+    //Put不是由该key借出（或已被销毁）的对象时panic(gomem.ErrUnknownObject)，用于调试；默认 false
+    Strict bool
+    //为true时Put的[]byte（或*[]byte）在归还前被填充为gomem.PoisonByte，使归还后仍使用对象的问题更易暴露，用于测试；默认 false
+    PoisonOnReturn bool
+    //对象工厂
+    Factory TypedKeyedPooledObjectFactory[K, T]
+
+    //inner vars
+    borrowChan chan *keyedWaiter[K, T]
+    cancelChan chan *keyedWaiter[K, T]
+    putChan    chan keyedObject[K, T]
+    clearChan  chan keyedClear[K]
+    cmdChan    chan func()
+    stop       chan bool
+    closing    chan bool
+    drained    chan bool
+    closed     int32
+    initOnce   sync.Once
+    initErr    error
+    stats      stats.Recorder
+    strict     strict.Tracker
+
+    //以下变量只能由内部协程访问
+    queues        map[K]*keyedQueue[T]
+    total         int
+    shuttingDown  bool
+    drainedClosed bool
+    //借出对象的借出时间，用于统计借出时长
+    lent map[keyedLent[K]][]time.Time
+}
+
+type keyedLent[K comparable] struct {
+    key K
+    obj interface{}
+}
+
+//单个key的对象队列
+type keyedQueue[T any] struct {
+    idle    *list.List
+    waiters *list.List
+    //该key下空闲及借出的对象总数
+    count int
+}
+
+type keyedWaiter[K comparable, T any] struct {
+    key   K
+    block bool
+    reply chan borrowResult[T]
+    elem  *list.Element
+}
+
+type keyedObject[K comparable, T any] struct {
+    key K
+    obj T
+}
+
+type keyedClear[K comparable] struct {
+    key  K
+    done chan bool
+}
+
+//根据cfg中的配置创建并初始化KeyedCommonPool，配置不合法时返回gomem.ErrInvalidConfig。
+//对象池使用cfg配置的副本，创建后修改cfg不会影响对象池；返回的对象池的配置项同样不能再修改
+func NewTypedKeyedCommonPool[K comparable, T any](cfg *TypedKeyedCommonPool[K, T]) (*TypedKeyedCommonPool[K, T], error) {
+    p := &TypedKeyedCommonPool[K, T]{}
+    objutil.CopyExported(p, cfg)
+    if err := p.lazyInit(); err != nil {
+        return nil, err
+    }
+    return p, nil
+}
+
+func NewKeyedCommonPool(cfg *KeyedCommonPool) (*KeyedCommonPool, error) {
+    return NewTypedKeyedCommonPool(cfg)
+}
+
+//只初始化一次，返回配置错误。未调用Init的对象池将在首次使用时自动初始化
+func (p *TypedKeyedCommonPool[K, T]) lazyInit() error {
+    p.initOnce.Do(func() {
+        if p.initErr = p.validate(); p.initErr == nil {
+            p.initDefault()
+            go p.loop()
+        }
+    })
+    return p.initErr
+}
+
+func (p *TypedKeyedCommonPool[K, T]) validate() error {
+    if p.Factory == nil {
+        return fmt.Errorf("%w: Factory is Empty", gomem.ErrInvalidConfig)
+    }
+    if p.MinIdlePerKey < 0 || p.MaxSizePerKey < 0 {
+        return fmt.Errorf("%w: MinIdlePerKey and MaxSizePerKey must not be negative", gomem.ErrInvalidConfig)
+    }
+    return nil
+}
+
+func (p *TypedKeyedCommonPool[K, T]) initDefault() {
+    if p.MaxSizePerKey == 0 {
+        p.MaxSizePerKey = 8
+    }
+    if p.MaxTotal == 0 {
+        p.MaxTotal = -1
+    }
+    if p.MaxWaitMillis == 0 {
+        p.MaxWaitMillis = -1
+    }
+    if p.MinEvictableIdleTimeMillis == 0 {
+        p.MinEvictableIdleTimeMillis = 30 * time.Minute
+    }
+    if p.TimeBetweenEvictionRunsMillis == 0 {
+        p.TimeBetweenEvictionRunsMillis = -1
+    }
+
+    p.borrowChan = make(chan *keyedWaiter[K, T])
+    p.cancelChan = make(chan *keyedWaiter[K, T])
+    p.putChan = make(chan keyedObject[K, T])
+    p.clearChan = make(chan keyedClear[K])
+    p.cmdChan = make(chan func())
+    p.stop = make(chan bool)
+    p.closing = make(chan bool)
+    p.drained = make(chan bool)
+
+    p.queues = map[K]*keyedQueue[T]{}
+    p.lent = map[keyedLent[K]][]time.Time{}
+    p.total = 0
+}
+
+//初始化对象池并启动内部协程。可重复、并发调用，只初始化一次；配置不合法时panic
+func (p *TypedKeyedCommonPool[K, T]) Init() {
+    if err := p.lazyInit(); err != nil {
+        panic(err)
+    }
+}
+
+//内部协程
+func (p *TypedKeyedCommonPool[K, T]) loop() {
+    var timer *time.Timer
+    if p.TimeBetweenEvictionRunsMillis == -1 {
+        timer = &time.Timer{C: make(chan time.Time)}
+    } else {
+        timer = time.NewTimer(p.TimeBetweenEvictionRunsMillis)
+    }
+
+    for {
+        select {
+        case <-p.stop:
+            return
+        case w := <-p.borrowChan:
+            p.borrow(w)
+        case w := <-p.cancelChan:
+            //已经交出的对象由等待者自行归还
+            if w.elem != nil {
+                p.queues[w.key].waiters.Remove(w.elem)
+                w.elem = nil
+            }
+        case o := <-p.putChan:
+            p.giveBack(o.key, o.obj)
+        case c := <-p.clearChan:
+            if q, ok := p.queues[c.key]; ok {
+                for q.idle.Len() > 0 {
+                    p.destoryObj(c.key, q, q.idle.Remove(q.idle.Front()).(*poolObject[T]).obj)
+                }
+            }
+            close(c.done)
+        case cmd := <-p.cmdChan:
+            cmd()
+        case <-timer.C:
+            p.evict()
+            timer = time.NewTimer(p.TimeBetweenEvictionRunsMillis)
+        }
+        if p.shuttingDown {
+            p.checkDrained()
+        } else {
+            p.serveAll()
+        }
+    }
+}
+
+//立即关闭对象池并销毁所有空闲对象，不等待借出的对象归还，相当于使用已结束的ctx调用Shutdown。可重复调用
+func (p *TypedKeyedCommonPool[K, T]) Close() {
+    ctx, cancel := context.WithCancel(context.Background())
+    cancel()
+    p.Shutdown(ctx)
+}
+
+//关闭对象池：新的借用者及正在等待的借用者获得gomem.ErrClosed，销毁所有key的空闲对象，
+//等待借出的对象归还并逐个销毁，直到全部归还或ctx结束。返回ctx结束时仍未归还的对象数量及ctx的错误，
+//重复调用时返回gomem.ErrClosed。关闭后归还的对象将被直接销毁
+func (p *TypedKeyedCommonPool[K, T]) Shutdown(ctx context.Context) (int, error) {
+    if err := p.lazyInit(); err != nil {
+        return 0, err
+    }
+    if !atomic.CompareAndSwapInt32(&p.closed, 0, 1) {
+        return 0, gomem.ErrClosed
+    }
+    close(p.closing)
+    p.exec(p.beginShutdown)
+
+    var err error
+    select {
+    case <-p.drained:
+    case <-ctx.Done():
+        err = ctx.Err()
+    }
+    n := 0
+    p.exec(func() {
+        n = p.total
+    })
+    close(p.stop)
+    if n == 0 {
+        return 0, nil
+    }
+    return n, err
+}
+
+//只能由内部协程调用
+func (p *TypedKeyedCommonPool[K, T]) beginShutdown() {
+    p.shuttingDown = true
+    for key, q := range p.queues {
+        for q.idle.Len() > 0 {
+            p.destoryObj(key, q, q.idle.Remove(q.idle.Front()).(*poolObject[T]).obj)
+        }
+        for q.waiters.Len() > 0 {
+            w := q.waiters.Remove(q.waiters.Front()).(*keyedWaiter[K, T])
+            w.elem = nil
+            w.reply <- borrowResult[T]{err: gomem.ErrClosed}
+        }
+    }
+}
+
+//借出的对象全部归还后通知Shutdown。只能由内部协程调用
+func (p *TypedKeyedCommonPool[K, T]) checkDrained() {
+    if !p.drainedClosed && p.total <= 0 {
+        p.drainedClosed = true
+        close(p.drained)
+    }
+}
+
+func (p *TypedKeyedCommonPool[K, T]) queue(key K) *keyedQueue[T] {
+    q, ok := p.queues[key]
+    if !ok {
+        q = &keyedQueue[T]{idle: list.New(), waiters: list.New()}
+        p.queues[key] = q
+    }
+    return q
+}
+
+func (p *TypedKeyedCommonPool[K, T]) borrow(w *keyedWaiter[K, T]) {
+    if p.shuttingDown {
+        w.reply <- borrowResult[T]{err: gomem.ErrClosed}
+        return
+    }
+    q := p.queue(w.key)
+    //已有等待者时排在其后
+    if q.waiters.Len() == 0 {
+        o, ok, err := p.take(w.key, q)
+        if ok || err != nil {
+            w.reply <- borrowResult[T]{obj: o, err: err}
+            return
+        }
+    }
+    if !w.block {
+        w.reply <- borrowResult[T]{err: gomem.ErrExhausted}
+        return
+    }
+    w.elem = q.waiters.PushBack(w)
+}
+
+//取出一个空闲对象，没有时尝试创建。返回false, nil表示已达到上限
+func (p *TypedKeyedCommonPool[K, T]) take(key K, q *keyedQueue[T]) (T, bool, error) {
+    for q.idle.Len() > 0 {
+        po := q.idle.Remove(q.idle.Front()).(*poolObject[T])
+        if p.activate(key, q, po.obj) == nil {
+            p.lend(key, po.obj)
+            return po.obj, true, nil
+        }
+    }
+
+    var o T
+    if q.count >= p.MaxSizePerKey {
+        return o, false, nil
+    }
+    if p.MaxTotal > 0 && p.total >= p.MaxTotal && !p.evictOldest(key) {
+        return o, false, nil
+    }
+    o, err := p.Factory.MakeObject(key)
+    if err != nil {
+        return o, false, factoryError(err)
+    }
+    if objutil.IsNil(o) {
+        return o, false, gomem.ErrFactory
+    }
+    p.stats.Created.Add(1)
+    q.count++
+    p.total++
+    if p.TestOnCreate {
+        if !p.Factory.ValidateObject(key, o) {
+            p.stats.ValidationFailures.Add(1)
+            p.destoryObj(key, q, o)
+            return o, false, gomem.ErrValidationFailed
+        }
+    }
+    if err := p.activate(key, q, o); err != nil {
+        return o, false, err
+    }
+    p.lend(key, o)
+    return o, true, nil
+}
+
+//记录对象的借出时间
+func (p *TypedKeyedCommonPool[K, T]) lend(key K, o T) {
+    p.stats.Borrowed.Add(1)
+    k := keyedLent[K]{key, objutil.Key(o)}
+    p.lent[k] = append(p.lent[k], time.Now())
+}
+
+//激活并验证对象，失败时对象将被销毁
+func (p *TypedKeyedCommonPool[K, T]) activate(key K, q *keyedQueue[T], o T) error {
+    if err := p.Factory.ActivateObject(key, o); err != nil {
+        p.destoryObj(key, q, o)
+        return factoryError(err)
+    }
+    if p.TestOnBorrow {
+        if !p.Factory.ValidateObject(key, o) {
+            p.stats.ValidationFailures.Add(1)
+            p.destoryObj(key, q, o)
+            return gomem.ErrValidationFailed
+        }
+    }
+    return nil
+}
+
+//用户归还对象，不是由该key借出的对象不计入该key的对象数量，将被忽略
+func (p *TypedKeyedCommonPool[K, T]) giveBack(key K, o T) {
+    p.stats.Returned.Add(1)
+    k := keyedLent[K]{key, objutil.Key(o)}
+    ts := p.lent[k]
+    if len(ts) == 0 {
+        return
+    }
+    p.stats.ActiveTime.Since(ts[len(ts)-1])
+    if len(ts) == 1 {
+        delete(p.lent, k)
+    } else {
+        p.lent[k] = ts[:len(ts)-1]
+    }
+    q := p.queue(key)
+    if p.shuttingDown {
+        p.destoryObj(key, q, o)
+        return
+    }
+    if p.TestOnReturn {
+        if !p.Factory.ValidateObject(key, o) {
+            p.stats.ValidationFailures.Add(1)
+            p.destoryObj(key, q, o)
+            return
+        }
+    }
+    if err := p.Factory.PassivateObject(key, o); err != nil {
+        p.destoryObj(key, q, o)
+        return
+    }
+    q.idle.PushBack(&poolObject[T]{when: time.Now(), state: IDLE, obj: o})
+}
+
+func (p *TypedKeyedCommonPool[K, T]) destoryObj(key K, q *keyedQueue[T], o T) {
+    p.stats.Destroyed.Add(1)
+    if p.Strict {
+        p.strict.Forget(keyedLent[K]{key, objutil.Key(o)})
+    }
+    p.Factory.DestroyObject(key, o)
+    q.count--
+    p.total--
+}
+
+//达到MaxTotal时，销毁除key以外空闲最久的对象
+func (p *TypedKeyedCommonPool[K, T]) evictOldest(key K) bool {
+    var oldestKey K
+    var oldest *keyedQueue[T]
+    for k, q := range p.queues {
+        if k == key || q.idle.Len() == 0 {
+            continue
+        }
+        if oldest == nil || q.idle.Front().Value.(*poolObject[T]).when.Before(oldest.idle.Front().Value.(*poolObject[T]).when) {
+            oldestKey, oldest = k, q
+        }
+    }
+    if oldest == nil {
+        return false
+    }
+    p.stats.Evicted.Add(1)
+    p.destoryObj(oldestKey, oldest, oldest.idle.Remove(oldest.idle.Front()).(*poolObject[T]).obj)
+    return true
+}
+
+func (p *TypedKeyedCommonPool[K, T]) evict() {
+    if p.MinEvictableIdleTimeMillis <= 0 {
+        return
+    }
+    for key, q := range p.queues {
+        for q.idle.Len() > p.MinIdlePerKey {
+            e := q.idle.Front()
+            if time.Since(e.Value.(*poolObject[T]).when) <= p.MinEvictableIdleTimeMillis {
+                break
+            }
+            p.stats.Evicted.Add(1)
+            p.destoryObj(key, q, q.idle.Remove(e).(*poolObject[T]).obj)
+        }
+    }
+}
+
+//对象归还或销毁后，将可用的对象交给等待者，并移除不再使用的key
+func (p *TypedKeyedCommonPool[K, T]) serveAll() {
+    for key, q := range p.queues {
+        for e := q.waiters.Front(); e != nil; e = q.waiters.Front() {
+            o, ok, err := p.take(key, q)
+            if !ok && err == nil {
+                break
+            }
+            w := q.waiters.Remove(e).(*keyedWaiter[K, T])
+            w.elem = nil
+            w.reply <- borrowResult[T]{obj: o, err: err}
+        }
+        if q.count == 0 && q.waiters.Len() == 0 {
+            delete(p.queues, key)
+        }
+    }
+}
+
+//失败时返回T的零值
+func (p *TypedKeyedCommonPool[K, T]) Get(key K) T {
+    ret, _ := p.Borrow(key)
+    return ret
+}
+
+//BlockWhenExhausted为false时，没有可用对象立即返回ErrExhausted；否则等待MaxWaitMillis，超时返回ErrTimeout
+func (p *TypedKeyedCommonPool[K, T]) Borrow(key K) (T, error) {
+    var timeout <-chan time.Time
+    if p.BlockWhenExhausted && p.MaxWaitMillis > 0 {
+        timer := time.NewTimer(p.MaxWaitMillis)
+        defer timer.Stop()
+        timeout = timer.C
+    }
+    start := time.Now()
+    o, err := p.wait(key, p.BlockWhenExhausted, nil, timeout)
+    p.recordBorrow(start, key, o, err)
+    return o, err
+}
+
+//与Get相同，但等待时间由ctx控制，MaxWaitMillis及BlockWhenExhausted对此方法无效
+func (p *TypedKeyedCommonPool[K, T]) GetContext(ctx context.Context, key K) (T, error) {
+    if err := ctx.Err(); err != nil {
+        var zero T
+        return zero, err
+    }
+    start := time.Now()
+    o, err := p.wait(key, true, ctx, nil)
+    p.recordBorrow(start, key, o, err)
+    return o, err
+}
+
+func (p *TypedKeyedCommonPool[K, T]) wait(key K, block bool, ctx context.Context, timeout <-chan time.Time) (T, error) {
+    var zero T
+    if err := p.lazyInit(); err != nil {
+        return zero, err
+    }
+    var done <-chan struct{}
+    if ctx != nil {
+        done = ctx.Done()
+    }
+
+    w := &keyedWaiter[K, T]{key: key, block: block, reply: make(chan borrowResult[T], 1)}
+    select {
+    case p.borrowChan <- w:
+    case <-p.closing:
+        return zero, gomem.ErrClosed
+    }
+
+    var err error
+    select {
+    case ret := <-w.reply:
+        return ret.obj, ret.err
+    case <-p.closing:
+        err = gomem.ErrClosed
+    case <-timeout:
+        err = gomem.ErrTimeout
+    case <-done:
+        err = ctx.Err()
+    }
+
+    //放弃等待，通知内部协程将其移出等待队列；若对象已经交出则归还对象池
+    select {
+    case p.cancelChan <- w:
+    case <-p.stop:
+        return zero, err
+    }
+    select {
+    case ret := <-w.reply:
+        if ret.err == nil {
+            p.put(key, ret.obj)
+        }
+    default:
+    }
+    return zero, err
+}
+
+//TestOnReturn为true时，验证失败的对象将被销毁；对象池关闭后归还的对象将被直接销毁。
+//不是由该key借出的对象将被忽略
+func (p *TypedKeyedCommonPool[K, T]) Put(key K, i T) {
+    if p.lazyInit() != nil {
+        return
+    }
+    if p.Strict {
+        if err := p.strict.Return(keyedLent[K]{key, objutil.Key(i)}, false); err != nil {
+            panic(fmt.Errorf("commonPool2: put %T with key %v: %w", i, key, err))
+        }
+    }
+    if p.PoisonOnReturn {
+        strict.Poison(i)
+    }
+    p.put(key, i)
+}
+
+func (p *TypedKeyedCommonPool[K, T]) put(key K, i T) {
+    select {
+    case p.putChan <- keyedObject[K, T]{key: key, obj: i}:
+    case <-p.stop:
+        p.stats.Returned.Add(1)
+        p.stats.Destroyed.Add(1)
+        p.Factory.DestroyObject(key, i)
+    }
+}
+
+//销毁key下所有的空闲对象
+func (p *TypedKeyedCommonPool[K, T]) Clear(key K) {
+    if p.lazyInit() != nil {
+        return
+    }
+    c := keyedClear[K]{key: key, done: make(chan bool)}
+    select {
+    case p.clearChan <- c:
+        <-c.done
+    case <-p.stop:
+    }
+}
+
+//在内部协程中执行f并等待其完成，对象池关闭时返回ErrClosed
+func (p *TypedKeyedCommonPool[K, T]) exec(f func()) error {
+    if err := p.lazyInit(); err != nil {
+        return err
+    }
+    done := make(chan bool)
+    select {
+    case p.cmdChan <- func() { f(); close(done) }:
+        <-done
+        return nil
+    case <-p.stop:
+        return gomem.ErrClosed
+    }
+}
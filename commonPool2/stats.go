@@ -0,0 +1,114 @@
+/**
+ * Copyright (C) 2019, Xiongfa Li.
+ * All right reserved.
+ * @author xiongfa.li
+ * @date 2019/3/20
+ * @time 14:20
+ * @version V1.0
+ * Description: 
+ */
+
+package commonPool
+
+import (
+    "github.com/xfali/gomem"
+    "github.com/xfali/gomem/internal/event"
+    "github.com/xfali/gomem/internal/objutil"
+    "github.com/xfali/gomem/internal/stats"
+    "github.com/xfali/gomem/internal/strict"
+    "sync/atomic"
+    "time"
+)
+
+//统计创建、销毁及验证失败次数，并通知创建、销毁事件的对象工厂
+type statsFactory[T any] struct {
+    TypedFallibleObjectFactory[T]
+    stats  *stats.Recorder
+    events *event.Dispatcher[T]
+    //Strict为true时停止跟踪销毁的对象
+    strict *strict.Tracker
+}
+
+func (f statsFactory[T]) MakeObject() (T, error) {
+    o, err := f.TypedFallibleObjectFactory.MakeObject()
+    if err == nil && !objutil.IsNil(o) {
+        f.stats.Created.Add(1)
+        f.events.Emit(gomem.EventCreate, o, -1, 0)
+    }
+    return o, err
+}
+
+func (f statsFactory[T]) DestroyObject(i T) {
+    f.stats.Destroyed.Add(1)
+    f.events.Emit(gomem.EventDestroy, i, INVALID, 0)
+    if f.strict != nil {
+        f.strict.Forget(i)
+    }
+    f.TypedFallibleObjectFactory.DestroyObject(i)
+}
+
+func (f statsFactory[T]) ValidateObject(i T) bool {
+    if f.TypedFallibleObjectFactory.ValidateObject(i) {
+        return true
+    }
+    f.stats.ValidationFailures.Add(1)
+    return false
+}
+
+//返回对象池的统计信息，可与借用、归还并发调用。对象池关闭后空闲及借出的数量为0
+func (p *TypedCommonPool[T]) Stats() gomem.PoolStats {
+    idle, active := 0, 0
+    p.exec(func() {
+        idle = p.queue.Len()
+        active = p.curCount - idle
+    })
+    s := p.stats.Snapshot(idle, active, int(atomic.LoadInt32(&p.waiters)))
+    s.DroppedEvents = p.events.Dropped()
+    return s
+}
+
+//成功借出时记录等待时间，超时时计数，并通知借出或超时事件
+func (p *TypedCommonPool[T]) recordBorrow(start time.Time, o T, err error) {
+    wait := time.Since(start)
+    if err == nil {
+        if p.Strict {
+            p.strict.Borrow(o)
+        }
+        p.stats.BorrowWait.Observe(wait)
+        p.events.Emit(gomem.EventBorrow, o, READY, wait)
+        return
+    }
+    if stats.IsTimeout(err) {
+        p.stats.Timeouts.Add(1)
+        p.events.Emit(gomem.EventTimeout, o, -1, wait)
+    }
+}
+
+//添加生命周期监听器，可在任意时刻调用，见gomem.TypedPoolListener
+func (p *TypedCommonPool[T]) AddListener(l gomem.TypedPoolListener[T]) {
+    p.events.Add(l)
+}
+
+//返回对象池的统计信息，可与借用、归还并发调用。对象池关闭后空闲、借出及等待的数量为0
+func (p *TypedKeyedCommonPool[K, T]) Stats() gomem.PoolStats {
+    idle, active, waiting := 0, 0, 0
+    p.exec(func() {
+        for _, q := range p.queues {
+            idle += q.idle.Len()
+            waiting += q.waiters.Len()
+        }
+        active = p.total - idle
+    })
+    return p.stats.Snapshot(idle, active, waiting)
+}
+
+func (p *TypedKeyedCommonPool[K, T]) recordBorrow(start time.Time, key K, o T, err error) {
+    if err == nil {
+        if p.Strict {
+            p.strict.Borrow(keyedLent[K]{key, objutil.Key(o)})
+        }
+        p.stats.BorrowWait.Since(start)
+        return
+    }
+    p.stats.Timeout(err)
+}
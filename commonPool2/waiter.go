@@ -0,0 +1,204 @@
+/**
+ * Copyright (C) 2019, Xiongfa Li.
+ * All right reserved.
+ * @author xiongfa.li
+ * @date 2019/3/14
+ * @time 16:05
+ * @version V1.0
+ * Description: 
+ */
+
+package commonPool
+
+import (
+    "container/list"
+    "context"
+    "github.com/xfali/gomem"
+    "sync/atomic"
+    "time"
+)
+
+const (
+    waiting   = iota //等待中
+    served           //内部协程已交付对象或错误
+    cancelled        //等待者已放弃
+)
+
+//Fairness为true时阻塞等待的借用者，及GetWithPriority的借用者，按优先级从高到低、同优先级按到达顺序排队
+type waiter[T any] struct {
+    //缓存为1，内部协程交付时不会阻塞
+    reply chan borrowResult[T]
+    //零值表示没有超时时间
+    deadline time.Time
+    priority int
+    state    int32
+}
+
+//交付前由内部协程调用，返回false表示等待者已放弃
+func (w *waiter[T]) serve() bool {
+    return atomic.CompareAndSwapInt32(&w.state, waiting, served)
+}
+
+//放弃等待，返回false表示内部协程已交付，此时必须取走reply中的结果
+func (w *waiter[T]) cancel() bool {
+    return atomic.CompareAndSwapInt32(&w.state, waiting, cancelled)
+}
+
+//排队等待内部协程交付对象，超时由内部协程统一处理，不需要为每次借用创建定时器
+func (p *TypedCommonPool[T]) waitFair(ctx context.Context, deadline time.Time, priority int) (T, error) {
+    var zero T
+    w := &waiter[T]{
+        reply:    make(chan borrowResult[T], 1),
+        deadline: deadline,
+        priority: priority,
+    }
+    select {
+    case p.waitChan <- w:
+    case <-p.closing:
+        return zero, gomem.ErrClosed
+    case <-ctx.Done():
+        return zero, ctx.Err()
+    }
+
+    select {
+    case ret := <-w.reply:
+        return p.borrowed(ret)
+    case <-p.closing:
+        if w.cancel() {
+            return zero, gomem.ErrClosed
+        }
+        return p.borrowed(<-w.reply)
+    case <-ctx.Done():
+        if w.cancel() {
+            return zero, ctx.Err()
+        }
+        //放弃前已被交付，取走结果以免对象泄漏
+        return p.borrowed(<-w.reply)
+    }
+}
+
+//新的等待者排在所有优先级不低于它的等待者之后，并清理队首已放弃的等待者。只能由内部协程调用
+func (p *TypedCommonPool[T]) enqueueWaiter(w *waiter[T]) {
+    if p.shuttingDown {
+        if w.serve() {
+            w.reply <- borrowResult[T]{err: gomem.ErrClosed}
+        }
+        return
+    }
+    for e := p.waitQueue.Front(); e != nil; e = p.waitQueue.Front() {
+        if atomic.LoadInt32(&e.Value.(*waiter[T]).state) != cancelled {
+            break
+        }
+        p.waitQueue.Remove(e)
+    }
+    e := p.waitQueue.Back()
+    for e != nil && e.Value.(*waiter[T]).priority < w.priority {
+        e = e.Prev()
+    }
+    if e == nil {
+        p.waitQueue.PushFront(w)
+    } else {
+        p.waitQueue.InsertAfter(w, e)
+    }
+    if !w.deadline.IsZero() && (p.waitDeadline.IsZero() || w.deadline.Before(p.waitDeadline)) {
+        p.resetWaitTimer(w.deadline)
+    }
+}
+
+//依次向队首的等待者交付可用对象或创建失败的错误，返回第一个未交付的可用对象。
+//队首等待者不能使用保留的对象时停止交付。只能由内部协程调用
+func (p *TypedCommonPool[T]) serveWaiters(e *list.Element) *list.Element {
+    for p.waitQueue.Len() > 0 && (e != nil || p.pendingErr != nil) {
+        f := p.waitQueue.Front()
+        w := f.Value.(*waiter[T])
+        if atomic.LoadInt32(&w.state) == cancelled {
+            p.waitQueue.Remove(f)
+            continue
+        }
+        if e != nil && !p.allowed(w.priority) {
+            break
+        }
+        if e != nil && w.priority < 0 && p.offerPlain(e) {
+            //不带优先级的借用者（优先级为0）先于低优先级的等待者获得对象
+            e = p.prepare()
+            continue
+        }
+        p.waitQueue.Remove(f)
+        if !w.serve() {
+            continue
+        }
+        var ret borrowResult[T]
+        if e != nil {
+            ret.po = e.Value.(*poolObject[T])
+            ret.obj = ret.po.obj
+            p.lend(e)
+        } else {
+            ret.err = p.pendingErr
+            p.pendingErr = nil
+        }
+        w.reply <- ret
+        e = p.prepare()
+    }
+    return e
+}
+
+//Fairness为false时，不排队的借用者在borrowChan或获取channel上等待，尝试将对象直接交给其中一个，
+//没有正在等待的借用者时返回false。只能由内部协程调用
+func (p *TypedCommonPool[T]) offerPlain(e *list.Element) bool {
+    if !p.allowed(0) {
+        return false
+    }
+    po := e.Value.(*poolObject[T])
+    select {
+    case p.borrowChan <- borrowResult[T]{obj: po.obj, po: po}:
+    case p.getChan <- po.obj:
+    default:
+        return false
+    }
+    p.lend(e)
+    return true
+}
+
+//向已超时的等待者返回ErrTimeout并移出队列，同时移除已放弃的等待者，然后按剩余最早的超时时间重置定时器。
+//只能由内部协程调用
+func (p *TypedCommonPool[T]) expireWaiters() {
+    now := time.Now()
+    var next time.Time
+    e := p.waitQueue.Front()
+    for e != nil {
+        cur := e
+        e = e.Next()
+        w := cur.Value.(*waiter[T])
+        if atomic.LoadInt32(&w.state) == cancelled {
+            p.waitQueue.Remove(cur)
+            continue
+        }
+        if w.deadline.IsZero() {
+            continue
+        }
+        if !w.deadline.After(now) {
+            p.waitQueue.Remove(cur)
+            if w.serve() {
+                w.reply <- borrowResult[T]{err: gomem.ErrTimeout}
+            }
+            continue
+        }
+        if next.IsZero() || w.deadline.Before(next) {
+            next = w.deadline
+        }
+    }
+    p.waitDeadline = time.Time{}
+    if !next.IsZero() {
+        p.resetWaitTimer(next)
+    }
+}
+
+//借出对象后剩余可借出的数量不少于ReservedCapacity，或优先级高于ReservedPriority时可以借出。只能由内部协程调用
+func (p *TypedCommonPool[T]) allowed(priority int) bool {
+    return priority > p.ReservedPriority || p.curCount-p.queue.Len() < p.MaxSize-p.ReservedCapacity
+}
+
+func (p *TypedCommonPool[T]) resetWaitTimer(deadline time.Time) {
+    p.waitDeadline = deadline
+    p.waitTimer.Reset(time.Until(deadline))
+}
@@ -0,0 +1,35 @@
+/**
+ * Copyright (C) 2019, Xiongfa Li.
+ * All right reserved.
+ * @author xiongfa.li
+ * @date 2019/2/25
+ * @time 10:15
+ * @version V1.0
+ * Description: 
+ */
+
+package gomem
+
+import "errors"
+
+//内置对象池通过Borrow、GetContext等方法返回的错误，可使用errors.Is判断
+var (
+    //对象池资源耗尽且不等待（如commonPool2的BlockWhenExhausted为false）
+    ErrExhausted = errors.New("gomem: pool exhausted")
+    //等待对象超时
+    ErrTimeout = errors.New("gomem: wait object timeout")
+    //对象池已关闭
+    ErrClosed = errors.New("gomem: pool closed")
+    //对象验证失败
+    ErrValidationFailed = errors.New("gomem: validate object failed")
+    //对象工厂创建或激活对象失败
+    ErrFactory = errors.New("gomem: object factory failed")
+    //对象不是由该对象池借出，或已被归还、销毁
+    ErrUnknownObject = errors.New("gomem: object not borrowed from this pool")
+    //严格模式下归还已归还的对象
+    ErrDoubleReturn = errors.New("gomem: object already returned to the pool")
+    //对象工厂连续失败，熔断期间不再创建对象
+    ErrCircuitOpen = errors.New("gomem: object factory circuit breaker open")
+    //对象池配置不合法
+    ErrInvalidConfig = errors.New("gomem: invalid pool config")
+)
@@ -0,0 +1,111 @@
+/**
+ * Copyright (C) 2019, Xiongfa Li.
+ * All right reserved.
+ * @author xiongfa.li
+ * @date 2019/3/4
+ * @time 10:30
+ * @version V1.0
+ * Description: 
+ */
+
+package gomem
+
+import "time"
+
+//回收策略使用的配置，由对象池根据自身配置生成
+type EvictionConfig struct {
+    //对象空闲的最小时间，达到此值后空闲对象将被移除。<=0 表示不按此规则移除
+    MinEvictableIdleTime time.Duration
+    //对象空闲的最小时间，达到此值且空闲对象数量大于MinIdle时将被移除。<=0 表示不按此规则移除
+    SoftMinEvictableIdleTime time.Duration
+    //池中最小保留的idle对象的数量
+    MinIdle int
+}
+
+//空闲对象的信息
+type PooledObjectInfo struct {
+    //对象创建时间
+    CreateTime time.Time
+    //最近一次被借出的时间，从未借出时为零值
+    LastBorrowTime time.Time
+    //最近一次被归还的时间，从未归还时为零值
+    LastReturnTime time.Time
+    //被借出的次数
+    BorrowCount int64
+}
+
+//对象进入空闲状态的时间
+func (info *PooledObjectInfo) IdleSince() time.Time {
+    if info.LastReturnTime.After(info.CreateTime) {
+        return info.LastReturnTime
+    }
+    return info.CreateTime
+}
+
+//回收策略，资源回收协程对每个被检查的空闲对象调用Evict，返回true时对象将被销毁
+type EvictionPolicy interface {
+    /*
+     config ：回收配置
+     info ：空闲对象的信息
+     idleCount ：当前空闲对象的数量
+     */
+    Evict(config *EvictionConfig, info *PooledObjectInfo, idleCount int) bool
+}
+
+//函数形式的回收策略
+type EvictionPolicyFunc func(config *EvictionConfig, info *PooledObjectInfo, idleCount int) bool
+
+func (f EvictionPolicyFunc) Evict(config *EvictionConfig, info *PooledObjectInfo, idleCount int) bool {
+    return f(config, info, idleCount)
+}
+
+//默认回收策略：空闲时间超过MinEvictableIdleTime，且空闲对象数量大于MinIdle时移除
+type DefaultEvictionPolicy struct{}
+
+func (DefaultEvictionPolicy) Evict(config *EvictionConfig, info *PooledObjectInfo, idleCount int) bool {
+    return config.MinEvictableIdleTime > 0 &&
+        time.Since(info.IdleSince()) > config.MinEvictableIdleTime &&
+        idleCount > config.MinIdle
+}
+
+//与Apache CommonPool2的默认策略一致：空闲时间超过SoftMinEvictableIdleTime且空闲对象数量大于MinIdle时移除，
+//或空闲时间超过MinEvictableIdleTime时不考虑MinIdle直接移除
+type SoftMinEvictableIdleTimePolicy struct{}
+
+func (SoftMinEvictableIdleTimePolicy) Evict(config *EvictionConfig, info *PooledObjectInfo, idleCount int) bool {
+    idle := time.Since(info.IdleSince())
+    if config.SoftMinEvictableIdleTime > 0 && idle > config.SoftMinEvictableIdleTime && idleCount > config.MinIdle {
+        return true
+    }
+    return config.MinEvictableIdleTime > 0 && idle > config.MinEvictableIdleTime
+}
+
+//对象创建后超过MaxLifetime即移除，不考虑空闲时间
+type MaxLifetimePolicy struct {
+    MaxLifetime time.Duration
+}
+
+func (p MaxLifetimePolicy) Evict(config *EvictionConfig, info *PooledObjectInfo, idleCount int) bool {
+    return p.MaxLifetime > 0 && time.Since(info.CreateTime) > p.MaxLifetime
+}
+
+//对象被借出MaxBorrowCount次后移除
+type MaxBorrowCountPolicy struct {
+    MaxBorrowCount int64
+}
+
+func (p MaxBorrowCountPolicy) Evict(config *EvictionConfig, info *PooledObjectInfo, idleCount int) bool {
+    return p.MaxBorrowCount > 0 && info.BorrowCount >= p.MaxBorrowCount
+}
+
+//组合多个回收策略，任意一个返回true时移除
+type AnyEvictionPolicy []EvictionPolicy
+
+func (policies AnyEvictionPolicy) Evict(config *EvictionConfig, info *PooledObjectInfo, idleCount int) bool {
+    for _, p := range policies {
+        if p.Evict(config, info, idleCount) {
+            return true
+        }
+    }
+    return false
+}
@@ -0,0 +1,135 @@
+/**
+ * Copyright (C) 2019, Xiongfa Li.
+ * All right reserved.
+ * @author xiongfa.li
+ * @date 2019/3/22
+ * @time 11:30
+ * @version V1.0
+ * Description: 
+ */
+
+//各对象池共用的生命周期事件通知
+package event
+
+import (
+    "github.com/xfali/gomem"
+    "sync"
+    "sync/atomic"
+    "time"
+)
+
+//待通知事件的最大数量
+const bufferSize = 1024
+
+//在独立的协程中按顺序通知监听器，零值可用。添加第一个监听器时启动通知协程
+type Dispatcher[T any] struct {
+    mutex     sync.Mutex
+    closed    bool
+    listeners atomic.Pointer[[]gomem.TypedPoolListener[T]]
+    events    chan gomem.TypedPoolEvent[T]
+    done      chan bool
+    dropped   atomic.Int64
+}
+
+//添加监听器，Close后添加的监听器不会收到通知
+func (d *Dispatcher[T]) Add(l gomem.TypedPoolListener[T]) {
+    d.mutex.Lock()
+    defer d.mutex.Unlock()
+
+    if d.closed {
+        return
+    }
+    var ls []gomem.TypedPoolListener[T]
+    if old := d.listeners.Load(); old != nil {
+        ls = append(ls, *old...)
+    } else {
+        d.events = make(chan gomem.TypedPoolEvent[T], bufferSize)
+        d.done = make(chan bool)
+        go d.loop()
+    }
+    ls = append(ls, l)
+    //events、done在listeners之前初始化，Load到listeners后即可使用
+    d.listeners.Store(&ls)
+}
+
+//是否有监听器，没有时对象池不需要生成事件
+func (d *Dispatcher[T]) Enabled() bool {
+    return d.listeners.Load() != nil
+}
+
+//提交事件，待通知事件过多时丢弃。不会阻塞
+func (d *Dispatcher[T]) Emit(typ gomem.EventType, obj T, from int, duration time.Duration) {
+    if !d.Enabled() {
+        return
+    }
+    select {
+    case <-d.done:
+        return
+    default:
+    }
+    select {
+    case d.events <- gomem.TypedPoolEvent[T]{Type: typ, Obj: obj, From: from, Duration: duration, Time: time.Now()}:
+    default:
+        d.dropped.Add(1)
+    }
+}
+
+//因监听器处理缓慢被丢弃的事件数量
+func (d *Dispatcher[T]) Dropped() int64 {
+    return d.dropped.Load()
+}
+
+//通知完已提交的事件后结束通知协程，可重复调用
+func (d *Dispatcher[T]) Close() {
+    d.mutex.Lock()
+    defer d.mutex.Unlock()
+
+    if d.closed {
+        return
+    }
+    d.closed = true
+    if d.done != nil {
+        close(d.done)
+    }
+}
+
+func (d *Dispatcher[T]) loop() {
+    for {
+        select {
+        case e := <-d.events:
+            d.notify(e)
+        case <-d.done:
+            for {
+                select {
+                case e := <-d.events:
+                    d.notify(e)
+                default:
+                    return
+                }
+            }
+        }
+    }
+}
+
+func (d *Dispatcher[T]) notify(e gomem.TypedPoolEvent[T]) {
+    for _, l := range *d.listeners.Load() {
+        switch e.Type {
+        case gomem.EventCreate:
+            l.OnCreate(e)
+        case gomem.EventActivate:
+            l.OnActivate(e)
+        case gomem.EventBorrow:
+            l.OnBorrow(e)
+        case gomem.EventReturn:
+            l.OnReturn(e)
+        case gomem.EventEvict:
+            l.OnEvict(e)
+        case gomem.EventInvalidate:
+            l.OnInvalidate(e)
+        case gomem.EventDestroy:
+            l.OnDestroy(e)
+        case gomem.EventTimeout:
+            l.OnTimeout(e)
+        }
+    }
+}
@@ -0,0 +1,106 @@
+/**
+ * Copyright (C) 2019, Xiongfa Li.
+ * All right reserved.
+ * @author xiongfa.li
+ * @date 2019/3/25
+ * @time 10:20
+ * @version V1.0
+ * Description: 
+ */
+
+//各对象池共用的泄漏检测，记录借出对象的时间及调用栈
+package leak
+
+import (
+    "github.com/xfali/gomem"
+    "github.com/xfali/gomem/internal/objutil"
+    "log"
+    "runtime"
+    "runtime/debug"
+    "sort"
+    "sync"
+    "time"
+)
+
+type record[T any] struct {
+    obj   T
+    time  time.Time
+    stack []byte
+}
+
+//借出对象的跟踪表，零值可用，所有方法均可并发调用
+type Tracker[T any] struct {
+    mutex sync.Mutex
+    lent  map[interface{}][]*record[T]
+}
+
+//记录借出对象的时间及当前协程的调用栈
+func (t *Tracker[T]) Borrow(obj T) {
+    r := &record[T]{obj: obj, time: time.Now(), stack: debug.Stack()}
+    key := objutil.Key(obj)
+    t.mutex.Lock()
+    defer t.mutex.Unlock()
+
+    if t.lent == nil {
+        t.lent = map[interface{}][]*record[T]{}
+    }
+    t.lent[key] = append(t.lent[key], r)
+}
+
+//移除归还对象的记录，值相同的对象移除最近借出的一个
+func (t *Tracker[T]) Return(obj T) {
+    key := objutil.Key(obj)
+    t.mutex.Lock()
+    defer t.mutex.Unlock()
+
+    rs := t.lent[key]
+    if len(rs) == 0 {
+        return
+    }
+    rs[len(rs)-1] = nil
+    if len(rs) == 1 {
+        delete(t.lent, key)
+    } else {
+        t.lent[key] = rs[:len(rs)-1]
+    }
+}
+
+//借出超过threshold未归还的对象，按借出时间排序
+func (t *Tracker[T]) Leaks(threshold time.Duration) []gomem.TypedLeakInfo[T] {
+    now := time.Now()
+    var ret []gomem.TypedLeakInfo[T]
+    t.mutex.Lock()
+    for _, rs := range t.lent {
+        for _, r := range rs {
+            if now.Sub(r.time) >= threshold {
+                ret = append(ret, gomem.TypedLeakInfo[T]{Obj: r.obj, BorrowTime: r.time, Stack: r.stack})
+            }
+        }
+    }
+    t.mutex.Unlock()
+    sort.Slice(ret, func(i, j int) bool { return ret[i].BorrowTime.Before(ret[j].BorrowTime) })
+    return ret
+}
+
+//创建句柄，并在句柄未Release即被垃圾回收时以prefix为前缀记录对象的借出时间及调用栈
+func (t *Tracker[T]) Handle(prefix string, obj T, release func(T)) *gomem.TypedHandle[T] {
+    h := gomem.NewTypedHandle(obj, release)
+    key := objutil.Key(obj)
+    t.mutex.Lock()
+    var r *record[T]
+    if rs := t.lent[key]; len(rs) > 0 {
+        r = rs[len(rs)-1]
+    }
+    t.mutex.Unlock()
+    if r == nil {
+        return h
+    }
+    //finalizer只引用借出记录，不引用句柄本身
+    runtime.SetFinalizer(h, func(h *gomem.TypedHandle[T]) {
+        if !h.Released() {
+            log.Printf("%s: object %v garbage collected without being returned, borrowed at %s, stack:\n%s",
+                prefix, r.obj, r.time.Format(time.RFC3339Nano), r.stack)
+        }
+    })
+    return h
+}
@@ -0,0 +1,162 @@
+/**
+ * Copyright (C) 2019, Xiongfa Li.
+ * All right reserved.
+ * @author xiongfa.li
+ * @date 2019/3/4
+ * @time 9:40
+ * @version V1.0
+ * Description: 
+ */
+
+//各对象池共用的对象辅助函数
+package objutil
+
+import (
+    "encoding/binary"
+    "math"
+    "math/rand"
+    "reflect"
+    "strings"
+    "time"
+)
+
+//判断对象是否为nil（包括nil指针、切片等），对象工厂返回nil视为创建失败
+func IsNil(i interface{}) bool {
+    if i == nil {
+        return true
+    }
+    v := reflect.ValueOf(i)
+    switch v.Kind() {
+    case reflect.Ptr, reflect.Map, reflect.Slice, reflect.Chan, reflect.Func, reflect.Interface:
+        return v.IsNil()
+    }
+    return false
+}
+
+//返回可作为map key的对象标识，用于跟踪借出的对象。
+//指针、切片等使用其地址，其他可比较的类型使用其值；不可比较的类型（如含切片字段的结构体）
+//逐字段展开，其中的引用类型字段使用其地址，因此持有不同底层数据的对象不会被视为同一对象
+func Key(i interface{}) interface{} {
+    if i == nil {
+        return nil
+    }
+    v := reflect.ValueOf(i)
+    switch v.Kind() {
+    case reflect.Slice, reflect.Map, reflect.Func, reflect.Chan, reflect.UnsafePointer:
+        return refKey{v.Type(), v.Pointer()}
+    }
+    //类型可比较时，接口字段中仍可能是不可比较的值（如[]byte），需要按实际的值判断
+    if v.Comparable() {
+        return i
+    }
+    var b strings.Builder
+    writeIdentity(&b, v)
+    return valueKey{v.Type(), b.String()}
+}
+
+type refKey struct {
+    t reflect.Type
+    p uintptr
+}
+
+type valueKey struct {
+    t reflect.Type
+    s string
+}
+
+//将v的标识写入b：引用类型写入地址（切片另加长度），复合类型递归写入各元素
+func writeIdentity(b *strings.Builder, v reflect.Value) {
+    var buf [8]byte
+    writeUint := func(u uint64) {
+        binary.LittleEndian.PutUint64(buf[:], u)
+        b.Write(buf[:])
+    }
+    switch v.Kind() {
+    case reflect.Bool:
+        if v.Bool() {
+            writeUint(1)
+        } else {
+            writeUint(0)
+        }
+    case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+        writeUint(uint64(v.Int()))
+    case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+        writeUint(v.Uint())
+    case reflect.Float32, reflect.Float64:
+        writeUint(math.Float64bits(v.Float()))
+    case reflect.Complex64, reflect.Complex128:
+        c := v.Complex()
+        writeUint(math.Float64bits(real(c)))
+        writeUint(math.Float64bits(imag(c)))
+    case reflect.String:
+        writeUint(uint64(v.Len()))
+        b.WriteString(v.String())
+    case reflect.Slice:
+        writeUint(uint64(v.Pointer()))
+        writeUint(uint64(v.Len()))
+    case reflect.Ptr, reflect.Map, reflect.Func, reflect.Chan, reflect.UnsafePointer:
+        writeUint(uint64(v.Pointer()))
+    case reflect.Array:
+        for i := 0; i < v.Len(); i++ {
+            writeIdentity(b, v.Index(i))
+        }
+    case reflect.Struct:
+        for i := 0; i < v.NumField(); i++ {
+            writeIdentity(b, v.Field(i))
+        }
+    case reflect.Interface:
+        if v.IsNil() {
+            writeUint(0)
+            return
+        }
+        e := v.Elem()
+        //同一内容不同动态类型的值不能视为同一对象
+        name := e.Type().String()
+        writeUint(uint64(len(name)))
+        b.WriteString(name)
+        writeIdentity(b, e)
+    }
+}
+
+//根据最大生存时间计算对象的过期时间，jitter>0时随机提前[0, jitter)，避免同时创建的对象同时过期。
+//maxLifetime<=0时返回零值，表示永不过期
+func Expiry(created time.Time, maxLifetime, jitter time.Duration) time.Time {
+    if maxLifetime <= 0 {
+        return time.Time{}
+    }
+    if jitter > 0 {
+        maxLifetime -= time.Duration(rand.Int63n(int64(jitter)))
+    }
+    return created.Add(maxLifetime)
+}
+
+//对象是否已超过Expiry返回的过期时间
+func Expired(expire time.Time) bool {
+    return !expire.IsZero() && time.Now().After(expire)
+}
+
+//第attempt次（从1开始）重试前的等待时间：base按2的幂次增长，不超过max，并随机缩短至多一半，避免多个协程同时重试
+func Backoff(base, max time.Duration, attempt int) time.Duration {
+    d := base
+    for i := 1; i < attempt && d < max; i++ {
+        d *= 2
+    }
+    if d > max {
+        d = max
+    }
+    if half := int64(d / 2); half > 0 {
+        d = time.Duration(half + rand.Int63n(half+1))
+    }
+    return d
+}
+
+//将src指向的结构体中所有导出字段复制到dst指向的结构体，用于根据配置创建对象池而不复制其内部状态
+func CopyExported(dst, src interface{}) {
+    d := reflect.ValueOf(dst).Elem()
+    s := reflect.ValueOf(src).Elem()
+    for i := 0; i < s.NumField(); i++ {
+        if s.Type().Field(i).IsExported() {
+            d.Field(i).Set(s.Field(i))
+        }
+    }
+}
@@ -0,0 +1,122 @@
+/**
+ * Copyright (C) 2019, Xiongfa Li.
+ * All right reserved.
+ * @author xiongfa.li
+ * @date 2019/3/20
+ * @time 10:40
+ * @version V1.0
+ * Description: 
+ */
+
+//各对象池共用的统计计数器，所有方法均可并发调用
+package stats
+
+import (
+    "context"
+    "errors"
+    "github.com/xfali/gomem"
+    "sort"
+    "sync/atomic"
+    "time"
+)
+
+//时间分布的边界
+var bounds = [...]time.Duration{
+    10 * time.Microsecond,
+    100 * time.Microsecond,
+    time.Millisecond,
+    5 * time.Millisecond,
+    10 * time.Millisecond,
+    25 * time.Millisecond,
+    50 * time.Millisecond,
+    100 * time.Millisecond,
+    250 * time.Millisecond,
+    500 * time.Millisecond,
+    time.Second,
+    2500 * time.Millisecond,
+    5 * time.Second,
+    10 * time.Second,
+}
+
+//时间分布
+type Histogram struct {
+    counts [len(bounds) + 1]atomic.Int64
+    count  atomic.Int64
+    sum    atomic.Int64
+    max    atomic.Int64
+}
+
+func (h *Histogram) Observe(d time.Duration) {
+    i := sort.Search(len(bounds), func(i int) bool { return d <= bounds[i] })
+    h.counts[i].Add(1)
+    h.count.Add(1)
+    h.sum.Add(int64(d))
+    for {
+        m := h.max.Load()
+        if int64(d) <= m || h.max.CompareAndSwap(m, int64(d)) {
+            return
+        }
+    }
+}
+
+//从start开始到现在的时间
+func (h *Histogram) Since(start time.Time) {
+    h.Observe(time.Since(start))
+}
+
+func (h *Histogram) Snapshot() gomem.DurationHistogram {
+    s := gomem.DurationHistogram{
+        Bounds: append([]time.Duration(nil), bounds[:]...),
+        Counts: make([]int64, len(h.counts)),
+        Count:  h.count.Load(),
+        Sum:    time.Duration(h.sum.Load()),
+        Max:    time.Duration(h.max.Load()),
+    }
+    for i := range h.counts {
+        s.Counts[i] = h.counts[i].Load()
+    }
+    return s
+}
+
+//对象池的计数器，零值可用
+type Recorder struct {
+    Created            atomic.Int64
+    Destroyed          atomic.Int64
+    Borrowed           atomic.Int64
+    Returned           atomic.Int64
+    ValidationFailures atomic.Int64
+    Evicted            atomic.Int64
+    Timeouts           atomic.Int64
+    BorrowWait         Histogram
+    ActiveTime         Histogram
+}
+
+//err为超时错误时计数
+func (r *Recorder) Timeout(err error) {
+    if IsTimeout(err) {
+        r.Timeouts.Add(1)
+    }
+}
+
+//是否为超时错误，包括gomem.ErrTimeout及ctx超过截止时间
+func IsTimeout(err error) bool {
+    return errors.Is(err, gomem.ErrTimeout) || errors.Is(err, context.DeadlineExceeded)
+}
+
+//返回计数器的快照，当前空闲、借出及等待的数量由对象池提供
+func (r *Recorder) Snapshot(idle, active, waiting int) gomem.PoolStats {
+    return gomem.PoolStats{
+        Created:            r.Created.Load(),
+        Destroyed:          r.Destroyed.Load(),
+        Borrowed:           r.Borrowed.Load(),
+        Returned:           r.Returned.Load(),
+        ValidationFailures: r.ValidationFailures.Load(),
+        Evicted:            r.Evicted.Load(),
+        Timeouts:           r.Timeouts.Load(),
+        Idle:               idle,
+        Active:             active,
+        Waiting:            waiting,
+        BorrowWait:         r.BorrowWait.Snapshot(),
+        ActiveTime:         r.ActiveTime.Snapshot(),
+    }
+}
@@ -0,0 +1,93 @@
+/**
+ * Copyright (C) 2019, Xiongfa Li.
+ * All right reserved.
+ * @author xiongfa.li
+ * @date 2019/3/27
+ * @time 16:05
+ * @version V1.0
+ * Description: 
+ */
+
+//各对象池共用的严格模式，跟踪对象标识以发现重复归还及归还外部对象
+package strict
+
+import (
+    "github.com/xfali/gomem"
+    "github.com/xfali/gomem/internal/objutil"
+    "sync"
+)
+
+//对象标识的跟踪表，零值可用，所有方法均可并发调用。
+//对象标识由objutil.Key决定，值相同的可比较对象视为同一对象
+type Tracker struct {
+    mutex sync.Mutex
+    //对象池发出的对象及其借出未归还的数量，归还后保留为0直到对象被销毁
+    lent map[interface{}]int
+}
+
+//记录借出的对象
+func (t *Tracker) Borrow(obj interface{}) {
+    key := objutil.Key(obj)
+    t.mutex.Lock()
+    defer t.mutex.Unlock()
+
+    if t.lent == nil {
+        t.lent = map[interface{}]int{}
+    }
+    t.lent[key]++
+}
+
+//记录归还的对象。对象已归还时返回gomem.ErrDoubleReturn；
+//对象不是由对象池发出（或已被销毁）时，acceptExternal为false返回gomem.ErrUnknownObject，否则开始跟踪该对象
+func (t *Tracker) Return(obj interface{}, acceptExternal bool) error {
+    key := objutil.Key(obj)
+    t.mutex.Lock()
+    defer t.mutex.Unlock()
+
+    n, ok := t.lent[key]
+    switch {
+    case !ok && !acceptExternal:
+        return gomem.ErrUnknownObject
+    case !ok:
+        if t.lent == nil {
+            t.lent = map[interface{}]int{}
+        }
+        t.lent[key] = 0
+    case n == 0:
+        return gomem.ErrDoubleReturn
+    default:
+        t.lent[key] = n - 1
+    }
+    return nil
+}
+
+//对象被销毁后停止跟踪，仍有借出未归还的同标识对象时保留
+func (t *Tracker) Forget(obj interface{}) {
+    key := objutil.Key(obj)
+    t.mutex.Lock()
+    defer t.mutex.Unlock()
+
+    if t.lent[key] == 0 {
+        delete(t.lent, key)
+    }
+}
+
+//使用gomem.PoisonByte填充归还的[]byte（包括*[]byte指向的切片）直至其容量，其他类型不做处理
+func Poison(obj interface{}) {
+    var b []byte
+    switch v := obj.(type) {
+    case []byte:
+        b = v
+    case *[]byte:
+        if v == nil {
+            return
+        }
+        b = *v
+    default:
+        return
+    }
+    b = b[:cap(b)]
+    for i := range b {
+        b[i] = gomem.PoisonByte
+    }
+}
@@ -0,0 +1,64 @@
+/**
+ * Copyright (C) 2019, Xiongfa Li.
+ * All right reserved.
+ * @author xiongfa.li
+ * @date 2019/3/25
+ * @time 9:50
+ * @version V1.0
+ * Description: 
+ */
+
+package gomem
+
+import (
+    "sync/atomic"
+    "time"
+)
+
+//对象池开启PoisonOnReturn时归还的[]byte被填充的字节，借出对象后读到此值说明其在归还后仍被使用
+const PoisonByte byte = 0xDE
+
+//对象类型为interface{}的LeakInfo
+type LeakInfo = TypedLeakInfo[interface{}]
+
+//借出后未归还的对象，由对象池的Leaks方法返回
+type TypedLeakInfo[T any] struct {
+    Obj T
+    //借出时间
+    BorrowTime time.Time
+    //借出对象的协程调用栈
+    Stack []byte
+}
+
+//对象类型为interface{}的Handle
+type Handle = TypedHandle[interface{}]
+
+//借出对象的句柄，使用完毕后调用Release归还对象。
+//对象池开启泄漏检测时，句柄未Release即被垃圾回收将记录日志
+type TypedHandle[T any] struct {
+    obj      T
+    release  func(T)
+    released int32
+}
+
+//供对象池实现使用，release为归还对象的函数
+func NewTypedHandle[T any](obj T, release func(T)) *TypedHandle[T] {
+    return &TypedHandle[T]{obj: obj, release: release}
+}
+
+//借出的对象，Release后不应再使用
+func (h *TypedHandle[T]) Value() T {
+    return h.obj
+}
+
+//归还对象，重复调用无效
+func (h *TypedHandle[T]) Release() {
+    if atomic.CompareAndSwapInt32(&h.released, 0, 1) {
+        h.release(h.obj)
+    }
+}
+
+//是否已调用Release
+func (h *TypedHandle[T]) Released() bool {
+    return atomic.LoadInt32(&h.released) == 1
+}
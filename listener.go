@@ -0,0 +1,101 @@
+/**
+ * Copyright (C) 2019, Xiongfa Li.
+ * All right reserved.
+ * @author xiongfa.li
+ * @date 2019/3/22
+ * @time 10:05
+ * @version V1.0
+ * Description: 
+ */
+
+package gomem
+
+import "time"
+
+//对象的状态，commonPool2中的同名常量与此相同
+const (
+    IDLE       = iota //在池中，处于空闲状态
+    ALLOCATED         //被使用中
+    EVICTION          //正在被逐出器验证
+    VALIDATION        //正在验证
+    INVALID           //驱逐测试或验证失败并将被销毁
+    ABANDONED         //对象被客户端拿出后，长时间未返回池中，或没有调用 use 方法，即被标记为抛弃的
+    READY             //可以被给客户端使用
+)
+
+//生命周期事件的类型
+type EventType int
+
+const (
+    EventCreate     EventType = iota //对象被创建
+    EventActivate                    //对象被激活
+    EventBorrow                      //对象被借出，Duration为借用者的等待时间
+    EventReturn                      //对象被归还，Duration为借出时长
+    EventEvict                       //对象因回收策略或超过MaxLifetime被移除，Duration为空闲时间
+    EventInvalidate                  //对象激活或验证失败、被InvalidateObject销毁或被当作遗弃对象
+    EventDestroy                     //对象被销毁
+    EventTimeout                     //借用者等待超时，Duration为等待时间
+)
+
+//对象类型为interface{}的PoolEvent
+type PoolEvent = TypedPoolEvent[interface{}]
+
+//生命周期事件
+type TypedPoolEvent[T any] struct {
+    Type EventType
+    //事件相关的对象，等待超时事件为T的零值
+    Obj T
+    //事件发生前对象的状态，如IDLE、ALLOCATED，没有之前的状态（创建、等待超时）时为-1
+    From int
+    //与事件相关的时间长度，见EventType的说明，没有时为0
+    Duration time.Duration
+    //事件发生的时间
+    Time time.Time
+}
+
+//对象类型为interface{}的PoolListener
+type PoolListener = TypedPoolListener[interface{}]
+
+//对象池生命周期监听器。事件由每个对象池独立的通知协程按发生顺序异步通知，
+//监听器处理缓慢导致待通知事件过多时新的事件将被丢弃并计入PoolStats.DroppedEvents，不会阻塞对象池。
+//对象池关闭后发生的事件不再通知
+type TypedPoolListener[T any] interface {
+    OnCreate(e TypedPoolEvent[T])
+    OnActivate(e TypedPoolEvent[T])
+    OnBorrow(e TypedPoolEvent[T])
+    OnReturn(e TypedPoolEvent[T])
+    OnEvict(e TypedPoolEvent[T])
+    OnInvalidate(e TypedPoolEvent[T])
+    OnDestroy(e TypedPoolEvent[T])
+    OnTimeout(e TypedPoolEvent[T])
+}
+
+//对象类型为interface{}的PoolListenerFuncs
+type PoolListenerFuncs = TypedPoolListenerFuncs[interface{}]
+
+//由函数组成的监听器，均可为nil
+type TypedPoolListenerFuncs[T any] struct {
+    Create     func(TypedPoolEvent[T])
+    Activate   func(TypedPoolEvent[T])
+    Borrow     func(TypedPoolEvent[T])
+    Return     func(TypedPoolEvent[T])
+    Evict      func(TypedPoolEvent[T])
+    Invalidate func(TypedPoolEvent[T])
+    Destroy    func(TypedPoolEvent[T])
+    Timeout    func(TypedPoolEvent[T])
+}
+
+func (l *TypedPoolListenerFuncs[T]) OnCreate(e TypedPoolEvent[T])     { call(l.Create, e) }
+func (l *TypedPoolListenerFuncs[T]) OnActivate(e TypedPoolEvent[T])   { call(l.Activate, e) }
+func (l *TypedPoolListenerFuncs[T]) OnBorrow(e TypedPoolEvent[T])     { call(l.Borrow, e) }
+func (l *TypedPoolListenerFuncs[T]) OnReturn(e TypedPoolEvent[T])     { call(l.Return, e) }
+func (l *TypedPoolListenerFuncs[T]) OnEvict(e TypedPoolEvent[T])      { call(l.Evict, e) }
+func (l *TypedPoolListenerFuncs[T]) OnInvalidate(e TypedPoolEvent[T]) { call(l.Invalidate, e) }
+func (l *TypedPoolListenerFuncs[T]) OnDestroy(e TypedPoolEvent[T])    { call(l.Destroy, e) }
+func (l *TypedPoolListenerFuncs[T]) OnTimeout(e TypedPoolEvent[T])    { call(l.Timeout, e) }
+
+func call[T any](f func(TypedPoolEvent[T]), e TypedPoolEvent[T]) {
+    if f != nil {
+        f(e)
+    }
+}
@@ -0,0 +1,207 @@
+/**
+ * Copyright (C) 2019, Xiongfa Li.
+ * All right reserved.
+ * @author xiongfa.li
+ * @date 2019/3/21
+ * @time 15:10
+ * @version V1.0
+ * Description: 
+ */
+
+//按名称注册对象池，以Prometheus文本格式及expvar导出对象池的统计信息，不依赖Prometheus客户端库
+package metrics
+
+import (
+    "bufio"
+    "errors"
+    "expvar"
+    "fmt"
+    "github.com/xfali/gomem"
+    "io"
+    "net/http"
+    "sort"
+    "strconv"
+    "strings"
+    "sync"
+    "time"
+)
+
+var (
+    //名称为空
+    ErrEmptyName = errors.New("metrics: empty pool name")
+    //名称已被注册
+    ErrDuplicateName = errors.New("metrics: pool name already registered")
+)
+
+//默认注册表，以"gomem"为名称发布到expvar
+var DefaultRegistry = NewRegistry()
+
+func init() {
+    DefaultRegistry.PublishExpvar("gomem")
+}
+
+//对象池注册表，实现了http.Handler，以Prometheus文本格式输出所有已注册对象池的统计信息
+type Registry struct {
+    mutex sync.RWMutex
+    pools map[string]gomem.StatsProvider
+}
+
+func NewRegistry() *Registry {
+    return &Registry{pools: map[string]gomem.StatsProvider{}}
+}
+
+//在默认注册表中注册对象池
+func Register(name string, pool gomem.StatsProvider) error {
+    return DefaultRegistry.Register(name, pool)
+}
+
+//从默认注册表中移除对象池
+func Unregister(name string) {
+    DefaultRegistry.Unregister(name)
+}
+
+//输出默认注册表的http.Handler
+func Handler() http.Handler {
+    return DefaultRegistry
+}
+
+//以name注册对象池，name将作为指标的pool标签。name为空时返回ErrEmptyName，已被注册时返回ErrDuplicateName
+func (r *Registry) Register(name string, pool gomem.StatsProvider) error {
+    if name == "" {
+        return ErrEmptyName
+    }
+    r.mutex.Lock()
+    defer r.mutex.Unlock()
+
+    if _, ok := r.pools[name]; ok {
+        return fmt.Errorf("%w: %s", ErrDuplicateName, name)
+    }
+    r.pools[name] = pool
+    return nil
+}
+
+//移除对象池，对象池关闭后应将其移除
+func (r *Registry) Unregister(name string) {
+    r.mutex.Lock()
+    defer r.mutex.Unlock()
+
+    delete(r.pools, name)
+}
+
+//按名称排序的所有对象池的统计信息
+func (r *Registry) snapshot() ([]string, map[string]gomem.PoolStats) {
+    r.mutex.RLock()
+    pools := make(map[string]gomem.StatsProvider, len(r.pools))
+    for name, pool := range r.pools {
+        pools[name] = pool
+    }
+    r.mutex.RUnlock()
+
+    //在锁外获取统计信息，避免阻塞注册
+    names := make([]string, 0, len(pools))
+    stats := make(map[string]gomem.PoolStats, len(pools))
+    for name, pool := range pools {
+        names = append(names, name)
+        stats[name] = pool.Stats()
+    }
+    sort.Strings(names)
+    return names, stats
+}
+
+//将所有对象池的统计信息发布到expvar，值为以对象池名称为key的gomem.PoolStats。
+//与expvar.Publish相同，name已被发布时panic
+func (r *Registry) PublishExpvar(name string) {
+    expvar.Publish(name, expvar.Func(func() interface{} {
+        _, stats := r.snapshot()
+        return stats
+    }))
+}
+
+func (r *Registry) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+    w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+    r.WriteText(w)
+}
+
+type metric struct {
+    name  string
+    help  string
+    value func(s *gomem.PoolStats) int64
+}
+
+var gauges = []metric{
+    {"gomem_pool_idle", "Number of idle objects in the pool.", func(s *gomem.PoolStats) int64 { return int64(s.Idle) }},
+    {"gomem_pool_active", "Number of objects borrowed from the pool.", func(s *gomem.PoolStats) int64 { return int64(s.Active) }},
+    {"gomem_pool_waiters", "Number of borrowers waiting for an object.", func(s *gomem.PoolStats) int64 { return int64(s.Waiting) }},
+}
+
+var counters = []metric{
+    {"gomem_pool_created_total", "Total number of objects created.", func(s *gomem.PoolStats) int64 { return s.Created }},
+    {"gomem_pool_destroyed_total", "Total number of objects destroyed.", func(s *gomem.PoolStats) int64 { return s.Destroyed }},
+    {"gomem_pool_borrowed_total", "Total number of objects borrowed.", func(s *gomem.PoolStats) int64 { return s.Borrowed }},
+    {"gomem_pool_returned_total", "Total number of objects returned.", func(s *gomem.PoolStats) int64 { return s.Returned }},
+    {"gomem_pool_validation_failures_total", "Total number of failed object validations.", func(s *gomem.PoolStats) int64 { return s.ValidationFailures }},
+    {"gomem_pool_evicted_total", "Total number of objects evicted.", func(s *gomem.PoolStats) int64 { return s.Evicted }},
+    {"gomem_pool_timeouts_total", "Total number of borrowers that timed out.", func(s *gomem.PoolStats) int64 { return s.Timeouts }},
+}
+
+type histogram struct {
+    name  string
+    help  string
+    value func(s *gomem.PoolStats) *gomem.DurationHistogram
+}
+
+var histograms = []histogram{
+    {"gomem_pool_borrow_wait_seconds", "Time borrowers waited before getting an object.", func(s *gomem.PoolStats) *gomem.DurationHistogram { return &s.BorrowWait }},
+    {"gomem_pool_active_seconds", "Time objects stayed borrowed before being returned.", func(s *gomem.PoolStats) *gomem.DurationHistogram { return &s.ActiveTime }},
+}
+
+//以Prometheus文本格式输出所有对象池的统计信息
+func (r *Registry) WriteText(w io.Writer) error {
+    names, stats := r.snapshot()
+    bw := bufio.NewWriter(w)
+    for _, m := range gauges {
+        writeMetric(bw, m, "gauge", names, stats)
+    }
+    for _, m := range counters {
+        writeMetric(bw, m, "counter", names, stats)
+    }
+    for _, h := range histograms {
+        fmt.Fprintf(bw, "# HELP %s %s\n# TYPE %s histogram\n", h.name, h.help, h.name)
+        for _, name := range names {
+            s := stats[name]
+            writeHistogram(bw, h.name, label(name), h.value(&s))
+        }
+    }
+    return bw.Flush()
+}
+
+func writeMetric(w io.Writer, m metric, typ string, names []string, stats map[string]gomem.PoolStats) {
+    fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s %s\n", m.name, m.help, m.name, typ)
+    for _, name := range names {
+        s := stats[name]
+        fmt.Fprintf(w, "%s{pool=\"%s\"} %d\n", m.name, label(name), m.value(&s))
+    }
+}
+
+//Prometheus的bucket为累计数量。总数由各区间累加，保证与bucket一致
+func writeHistogram(w io.Writer, name, pool string, h *gomem.DurationHistogram) {
+    var n int64
+    for i, bound := range h.Bounds {
+        n += h.Counts[i]
+        fmt.Fprintf(w, "%s_bucket{pool=\"%s\",le=\"%s\"} %d\n", name, pool, seconds(bound), n)
+    }
+    n += h.Counts[len(h.Bounds)]
+    fmt.Fprintf(w, "%s_bucket{pool=\"%s\",le=\"+Inf\"} %d\n", name, pool, n)
+    fmt.Fprintf(w, "%s_sum{pool=\"%s\"} %s\n", name, pool, seconds(h.Sum))
+    fmt.Fprintf(w, "%s_count{pool=\"%s\"} %d\n", name, pool, n)
+}
+
+func seconds(d time.Duration) string {
+    return strconv.FormatFloat(d.Seconds(), 'g', -1, 64)
+}
+
+var labelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+func label(s string) string {
+    return labelEscaper.Replace(s)
+}
@@ -10,8 +10,13 @@
 
 package gomem
 
-//对象池接口，比系统自带sync.Pool功能强，性能待测试
-type Pool interface {
+import "context"
+
+//对象池接口，等价于TypedPool[interface{}]
+type Pool = TypedPool[interface{}]
+
+//类型安全的对象池接口，比系统自带sync.Pool功能强，性能待测试。T为池中对象的类型
+type TypedPool[T any] interface {
     /*
      初始化对象池
      return ：
@@ -24,7 +29,7 @@ type Pool interface {
         2、commonPool: 禁止使用
         3、commonPool2: 不建议使用
      */
-    Init() (<-chan interface{}, chan<- interface{})
+    Init() (<-chan T, chan<- T)
     /*
      关闭对象池，回收资源
      */
@@ -32,9 +37,23 @@ type Pool interface {
     /*
      获得一个对象，根据实现可能会阻塞
      */
-    Get() interface{}
+    Get() T
+    /*
+     获得一个对象，阻塞等待直到获得对象或ctx被取消、超时
+     return ：
+        1、获得的对象
+        2、ctx被取消或超时时返回ctx.Err()，此时不会占用任何对象
+     */
+    GetContext(ctx context.Context) (T, error)
+    /*
+     获得一个对象，等待策略与Get一致
+     return ：
+        1、获得的对象
+        2、失败时返回错误，可通过errors.Is与ErrExhausted、ErrTimeout、ErrClosed、ErrValidationFailed、ErrFactory比较
+     */
+    Borrow() (T, error)
     /*
      回收一个对象，根据实现可能会阻塞
      */
-    Put(interface{})
+    Put(T)
 }
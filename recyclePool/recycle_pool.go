@@ -12,43 +12,209 @@ package recyclePool
 
 import (
     "container/list"
+    "context"
+    "fmt"
+    "github.com/xfali/gomem"
+    "github.com/xfali/gomem/internal/event"
+    "github.com/xfali/gomem/internal/leak"
+    "github.com/xfali/gomem/internal/objutil"
+    "github.com/xfali/gomem/internal/stats"
+    "github.com/xfali/gomem/internal/strict"
+    "sync"
+    "sync/atomic"
     "time"
 )
 
-type RecyclePool struct {
+const (
+    WhenExhaustedBlock = iota //阻塞等待对象归还
+    WhenExhaustedFail         //立即返回gomem.ErrExhausted
+    WhenExhaustedNew          //创建一个不计入MaxSize的对象，归还时超出MaxSize的对象将被释放
+)
+
+//对象类型为interface{}的RecyclePool
+type RecyclePool = TypedRecyclePool[interface{}]
+
+//类型安全的RecyclePool，T为池中对象的类型
+//导出字段均为配置项，只能在Init或首次使用之前设置；之后由内部协程并发读取，修改属于数据竞争
+type TypedRecyclePool[T any] struct {
     //对象空闲的最小时间，达到此值后空闲对象将可能会被移除。-1 表示不移除；默认 30 分钟
     MinEvictableIdleTimeMillis time.Duration
     //回收资源协程的执行周期，默认 -1 表示不定时回收
     TimeBetweenEvictionRunsMillis time.Duration
+    //回收策略，决定空闲对象是否需要移除，默认 gomem.DefaultEvictionPolicy。
+    //设置后对象池将跟踪借出的对象以记录其创建时间、借出次数等信息，此时借出的对象必须归还，否则其信息将一直被保留
+    EvictionPolicy gomem.EvictionPolicy
+    //对象的最大生存时间，超过此时间的对象在借出或归还时将被释放。<=0 表示不限制；默认 0。
+    //设置后同样会跟踪借出的对象，借出的对象必须归还
+    MaxLifetime time.Duration
+    //每个对象的最大生存时间随机缩短[0, MaxLifetimeJitter)，避免同时创建的对象同时过期；默认 0
+    MaxLifetimeJitter time.Duration
+    //空闲对象是否后进先出，默认 false 即先进先出。为true时优先借出最近归还的对象，长时间未被使用的对象可被定时回收
+    Lifo bool
+    //最大对象数量（空闲及借出的对象），默认 0 表示不限制。借出的对象必须归还，否则一直占用名额
+    MaxSize int
+    //最大空闲对象数量，空闲对象已达到此数量时归还的对象将被释放，默认 0 表示不限制
+    MaxIdle int
+    //对象数量达到MaxSize时Get、Borrow、GetContext的行为，默认 WhenExhaustedBlock。Init返回的获取channel总是阻塞等待
+    WhenExhausted int
+    //为true时记录借出对象的时间及借出协程的调用栈，通过Leaks查看未归还的对象，用于调试；默认 false。
+    //只跟踪通过Get、Borrow、GetContext借出并通过Put归还的对象
+    DetectLeaks bool
+    //Leaks列出借出超过此时间仍未归还的对象，默认 0 表示列出所有未归还的对象
+    LeakThreshold time.Duration
+    //为true时跟踪对象标识，Put已归还的对象时panic(gomem.ErrDoubleReturn)，
+    //Put不是由对象池借出（或已被释放）的对象时panic(gomem.ErrUnknownObject)，用于调试；默认 false。
+    //只检查通过Get、Borrow、GetContext借出并通过Put归还的对象，值相同的可比较对象（如int）视为同一对象
+    Strict bool
+    //为true时Put的[]byte（或*[]byte）在归还前被填充为gomem.PoisonByte，使归还后仍使用对象的问题更易暴露，用于测试；默认 false
+    PoisonOnReturn bool
     //创建对象函数
-    New      func() interface{}
+    New      func() T
     //释放对象函数
-    Delete   func(interface{})
+    Delete   func(T)
+
+    get   chan T
+    give  chan T
+    try   chan chan tryResult[T]
+    //Stats时由内部协程回复空闲对象数量
+    idle  chan chan int
+    stop  chan bool
+    track bool
+    //Shutdown时通知内部协程，内部协程销毁空闲对象后关闭回复的channel
+    shut    chan chan bool
+    closing chan bool
+    drained chan bool
+    closed  int32
+    initOnce sync.Once
+    initErr  error
+    //借出未归还的对象数量，不含WhenExhaustedNew创建的对象，只由内部协程修改
+    borrowed int32
+    waiters  int32
+    stats    stats.Recorder
+    events   event.Dispatcher[T]
+    leaks    leak.Tracker[T]
+    strict   strict.Tracker
+}
+
+type tryResult[T any] struct {
+    obj T
+    ok  bool
+}
+
+type poolObject[T any] struct {
+    obj         T
+    created     time.Time
+    expire      time.Time
+    lastBorrow  time.Time
+    lastReturn  time.Time
+    borrowCount int64
+}
+
+func (m *TypedRecyclePool[T]) newPoolObject(o T) *poolObject[T] {
+    now := time.Now()
+    return &poolObject[T]{
+        obj:     o,
+        created: now,
+        expire:  objutil.Expiry(now, m.MaxLifetime, m.MaxLifetimeJitter),
+    }
+}
+
+func (po *poolObject[T]) info() *gomem.PooledObjectInfo {
+    return &gomem.PooledObjectInfo{
+        CreateTime:     po.created,
+        LastBorrowTime: po.lastBorrow,
+        LastReturnTime: po.lastReturn,
+        BorrowCount:    po.borrowCount,
+    }
+}
 
-    get  chan interface{}
-    give chan interface{}
-    stop chan bool
+//根据cfg中的配置创建并初始化RecyclePool，配置不合法时返回gomem.ErrInvalidConfig。
+//对象池使用cfg配置的副本，创建后修改cfg不会影响对象池；返回的对象池的配置项同样不能再修改
+func NewTypedRecyclePool[T any](cfg *TypedRecyclePool[T]) (*TypedRecyclePool[T], error) {
+    m := &TypedRecyclePool[T]{}
+    objutil.CopyExported(m, cfg)
+    if err := m.lazyInit(); err != nil {
+        return nil, err
+    }
+    return m, nil
+}
+
+func NewRecyclePool(cfg *RecyclePool) (*RecyclePool, error) {
+    return NewTypedRecyclePool(cfg)
+}
+
+//支持直接使用获取、回收channel，可以使用。可重复、并发调用，只初始化一次；配置不合法时panic。
+//未调用Init时其他方法将自动初始化对象池
+func (m *TypedRecyclePool[T]) Init() (<-chan T, chan<- T) {
+    if err := m.lazyInit(); err != nil {
+        panic(err)
+    }
+    return m.get, m.give
 }
 
-type poolObject struct {
-    when time.Time
-    obj  interface{}
+func (m *TypedRecyclePool[T]) lazyInit() error {
+    m.initOnce.Do(func() {
+        if m.initErr = m.validate(); m.initErr == nil {
+            m.start()
+        }
+    })
+    return m.initErr
 }
 
-//支持直接使用获取、回收channel，可以使用
-func (m *RecyclePool) Init() (<-chan interface{}, chan<- interface{}) {
+func (m *TypedRecyclePool[T]) validate() error {
+    if m.New == nil {
+        return fmt.Errorf("%w: New is nil", gomem.ErrInvalidConfig)
+    }
+    if m.MaxSize < 0 || m.MaxIdle < 0 {
+        return fmt.Errorf("%w: MaxSize and MaxIdle must not be negative", gomem.ErrInvalidConfig)
+    }
+    if m.WhenExhausted < WhenExhaustedBlock || m.WhenExhausted > WhenExhaustedNew {
+        return fmt.Errorf("%w: unknown WhenExhausted %d", gomem.ErrInvalidConfig, m.WhenExhausted)
+    }
+    return nil
+}
+
+func (m *TypedRecyclePool[T]) start() {
     if m.MinEvictableIdleTimeMillis == 0 {
         m.MinEvictableIdleTimeMillis = 30*time.Minute
     }
     if m.TimeBetweenEvictionRunsMillis == 0 {
         m.TimeBetweenEvictionRunsMillis = -1
     }
-    m.get = make(chan interface{})
-    m.give = make(chan interface{})
+    m.track = m.EvictionPolicy != nil || m.MaxLifetime > 0
+    if m.EvictionPolicy == nil {
+        m.EvictionPolicy = gomem.DefaultEvictionPolicy{}
+    }
+    m.get = make(chan T)
+    m.give = make(chan T)
+    m.try = make(chan chan tryResult[T])
+    m.idle = make(chan chan int)
     m.stop = make(chan bool)
+    m.shut = make(chan chan bool)
+    m.closing = make(chan bool)
+    m.drained = make(chan bool)
 
     go func() {
         queue := list.New()
+        //借出的对象，归还时用于找回其创建时间、借出次数等信息
+        active := map[interface{}][]*poolObject[T]{}
+        shuttingDown := false
+        drainedClosed := false
+        lend := func(e *list.Element) {
+            po := queue.Remove(e).(*poolObject[T])
+            if objutil.IsNil(po.obj) {
+                //New返回nil，借用者得到ErrFactory，没有对象可以归还，不占用MaxSize名额
+                return
+            }
+            po.lastBorrow = time.Now()
+            po.borrowCount++
+            atomic.AddInt32(&m.borrowed, 1)
+            m.stats.Borrowed.Add(1)
+            if m.track && !objutil.IsNil(po.obj) {
+                key := objutil.Key(po.obj)
+                active[key] = append(active[key], po)
+            }
+        }
         var timer *time.Timer
         if m.TimeBetweenEvictionRunsMillis <= 0 {
             timer = &time.Timer{C: make(chan time.Time)}
@@ -56,49 +222,377 @@ func (m *RecyclePool) Init() (<-chan interface{}, chan<- interface{}) {
             timer = time.NewTimer(m.TimeBetweenEvictionRunsMillis)
         }
         for {
-            if queue.Len() == 0 {
-                queue.PushBack(poolObject{when: time.Now(), obj: m.New()})
+            var get chan T
+            var obj T
+            var e *list.Element
+            //等待借出期间队首对象可能过期，到期时重新检查
+            var expireTimer *time.Timer
+            var expire <-chan time.Time
+            if shuttingDown {
+                //借出的对象全部归还后通知Shutdown
+                if atomic.LoadInt32(&m.borrowed) == 0 && !drainedClosed {
+                    drainedClosed = true
+                    close(m.drained)
+                }
+            } else {
+                //过期的对象不再借出
+                for queue.Len() > 0 && objutil.Expired(queue.Front().Value.(*poolObject[T]).expire) {
+                    m.evict(queue.Remove(queue.Front()).(*poolObject[T]))
+                }
+                if queue.Len() == 0 && (m.MaxSize <= 0 || int(atomic.LoadInt32(&m.borrowed)) < m.MaxSize) {
+                    queue.PushBack(m.newPoolObject(m.create()))
+                }
+                //对象数量已达到MaxSize时不再借出，等待对象归还
+                e = queue.Front()
+                if e != nil {
+                    get = m.get
+                    obj = e.Value.(*poolObject[T]).obj
+                    if exp := e.Value.(*poolObject[T]).expire; !exp.IsZero() {
+                        expireTimer = time.NewTimer(time.Until(exp))
+                        expire = expireTimer.C
+                    }
+                }
             }
-            e := queue.Front()
 
             select {
             case <-m.stop:
                 return
+            case ack := <-m.shut:
+                shuttingDown = true
+                for queue.Len() > 0 {
+                    m.delete(queue.Remove(queue.Front()).(*poolObject[T]).obj)
+                }
+                close(ack)
             case b := <-m.give:
                 //timer.Stop()
-                queue.PushBack(poolObject{when: time.Now(), obj: b})
-            case m.get <- e.Value.(poolObject).obj:
+                if objutil.IsNil(b) {
+                    break
+                }
+                m.stats.Returned.Add(1)
+                var po *poolObject[T]
+                if m.track {
+                    key := objutil.Key(b)
+                    if pos := active[key]; len(pos) > 0 {
+                        po = pos[len(pos)-1]
+                        if len(pos) == 1 {
+                            delete(active, key)
+                        } else {
+                            active[key] = pos[:len(pos)-1]
+                        }
+                    }
+                }
+                var active time.Duration
+                if po == nil {
+                    po = m.newPoolObject(b)
+                } else {
+                    //借出记录只用于找回对象信息，回收的始终是归还的对象
+                    po.obj = b
+                    active = time.Since(po.lastBorrow)
+                    m.stats.ActiveTime.Observe(active)
+                }
+                m.events.Emit(gomem.EventReturn, b, gomem.ALLOCATED, active)
+                if atomic.LoadInt32(&m.borrowed) > 0 {
+                    atomic.AddInt32(&m.borrowed, -1)
+                } else if m.MaxSize > 0 {
+                    //没有借出的对象时，归还的是WhenExhaustedNew创建或外部的对象，超出MaxSize
+                    m.delete(b)
+                    break
+                }
+                if !shuttingDown && objutil.Expired(po.expire) {
+                    m.stats.Evicted.Add(1)
+                    m.events.Emit(gomem.EventEvict, b, gomem.ALLOCATED, 0)
+                    m.delete(b)
+                    break
+                }
+                if shuttingDown || (m.MaxIdle > 0 && queue.Len() >= m.MaxIdle) {
+                    m.delete(b)
+                    break
+                }
+                po.lastReturn = time.Now()
+                if m.Lifo {
+                    queue.PushFront(po)
+                } else {
+                    queue.PushBack(po)
+                }
+            case get <- obj:
                 //timer.Stop()
-                queue.Remove(e)
+                lend(e)
+            case reply := <-m.try:
+                if e != nil {
+                    lend(e)
+                }
+                reply <- tryResult[T]{obj: obj, ok: e != nil}
+            case reply := <-m.idle:
+                reply <- queue.Len()
+            case <-expire:
+                //队首对象已过期，下一轮循环时移除
             case <-timer.C:
+                config := &gomem.EvictionConfig{MinEvictableIdleTime: m.MinEvictableIdleTimeMillis}
                 e := queue.Front()
                 next := e
                 for e != nil {
                     next = e.Next()
-                    if m.MinEvictableIdleTimeMillis > 0 && time.Since(e.Value.(poolObject).when) > m.MinEvictableIdleTimeMillis  {
-                        queue.Remove(e)
-                        if m.Delete != nil {
-                            m.Delete(e.Value.(poolObject).obj)
-                        }
+                    if m.EvictionPolicy.Evict(config, e.Value.(*poolObject[T]).info(), queue.Len()) {
+                        m.evict(queue.Remove(e).(*poolObject[T]))
                         e.Value = nil
                     }
                     e = next
                 }
                 timer = time.NewTimer(m.TimeBetweenEvictionRunsMillis)
             }
+            if expireTimer != nil {
+                expireTimer.Stop()
+            }
         }
     }()
-    return m.get, m.give
 }
 
-func (m *RecyclePool) Close() {
+//创建对象，New返回nil时不计入创建数量
+func (m *TypedRecyclePool[T]) create() T {
+    o := m.New()
+    if !objutil.IsNil(o) {
+        m.stats.Created.Add(1)
+        m.events.Emit(gomem.EventCreate, o, -1, 0)
+    }
+    return o
+}
+
+//释放因回收策略或超过MaxLifetime被移除的空闲对象
+func (m *TypedRecyclePool[T]) evict(po *poolObject[T]) {
+    m.stats.Evicted.Add(1)
+    m.events.Emit(gomem.EventEvict, po.obj, gomem.IDLE, time.Since(po.info().IdleSince()))
+    m.delete(po.obj)
+}
+
+func (m *TypedRecyclePool[T]) delete(o T) {
+    m.stats.Destroyed.Add(1)
+    m.events.Emit(gomem.EventDestroy, o, gomem.INVALID, 0)
+    if m.Strict {
+        m.strict.Forget(o)
+    }
+    if m.Delete != nil {
+        m.Delete(o)
+    }
+}
+
+//立即关闭对象池并释放所有空闲对象，不等待借出的对象归还，相当于使用已结束的ctx调用Shutdown
+func (m *TypedRecyclePool[T]) Close() {
+    ctx, cancel := context.WithCancel(context.Background())
+    cancel()
+    m.Shutdown(ctx)
+}
+
+//关闭对象池：新的借用者及正在等待的借用者获得gomem.ErrClosed，释放所有空闲对象，
+//等待借出的对象归还并逐个释放，直到全部归还或ctx结束。返回ctx结束时仍未归还的对象数量及ctx的错误，
+//重复调用时返回gomem.ErrClosed。关闭后通过Put归还的对象将被直接释放，Init返回的channel不再可用
+func (m *TypedRecyclePool[T]) Shutdown(ctx context.Context) (int, error) {
+    if err := m.lazyInit(); err != nil {
+        return 0, err
+    }
+    if !atomic.CompareAndSwapInt32(&m.closed, 0, 1) {
+        return 0, gomem.ErrClosed
+    }
+    close(m.closing)
+    ack := make(chan bool)
+    m.shut <- ack
+    <-ack
+
+    var err error
+    select {
+    case <-m.drained:
+    case <-ctx.Done():
+        err = ctx.Err()
+    }
     close(m.stop)
+    m.events.Close()
+    n := int(atomic.LoadInt32(&m.borrowed))
+    if n == 0 {
+        return 0, nil
+    }
+    return n, err
+}
+
+//对象池关闭后返回T的零值
+func (m *TypedRecyclePool[T]) Get() T {
+    o, _ := m.Borrow()
+    return o
+}
+
+//MaxSize为0时不会返回ErrExhausted；New返回nil时返回ErrFactory
+func (m *TypedRecyclePool[T]) Borrow() (T, error) {
+    start := time.Now()
+    atomic.AddInt32(&m.waiters, 1)
+    o, err := m.borrow()
+    atomic.AddInt32(&m.waiters, -1)
+    m.recordBorrow(start, o, err)
+    return o, err
+}
+
+func (m *TypedRecyclePool[T]) borrow() (T, error) {
+    if err := m.lazyInit(); err != nil {
+        var zero T
+        return zero, err
+    }
+    if m.WhenExhausted != WhenExhaustedBlock && m.MaxSize > 0 {
+        return m.tryBorrow()
+    }
+    select {
+    case o := <-m.get:
+        return m.checkObj(o)
+    case <-m.closing:
+        var zero T
+        return zero, gomem.ErrClosed
+    }
 }
 
-func (m *RecyclePool) Get() interface{} {
-    return <-m.get
+//get为无缓存channel，ctx结束时对象不会被交出，因此放弃等待不会造成对象泄漏
+func (m *TypedRecyclePool[T]) GetContext(ctx context.Context) (T, error) {
+    start := time.Now()
+    atomic.AddInt32(&m.waiters, 1)
+    o, err := m.getContext(ctx)
+    atomic.AddInt32(&m.waiters, -1)
+    m.recordBorrow(start, o, err)
+    return o, err
 }
 
-func (m *RecyclePool) Put(i interface{}) {
-    m.give <- i
+func (m *TypedRecyclePool[T]) getContext(ctx context.Context) (T, error) {
+    var zero T
+    if err := ctx.Err(); err != nil {
+        return zero, err
+    }
+    if err := m.lazyInit(); err != nil {
+        return zero, err
+    }
+    if m.WhenExhausted != WhenExhaustedBlock && m.MaxSize > 0 {
+        return m.tryBorrow()
+    }
+    select {
+    case o := <-m.get:
+        return m.checkObj(o)
+    case <-m.closing:
+        return zero, gomem.ErrClosed
+    case <-ctx.Done():
+        return zero, ctx.Err()
+    }
+}
+
+//由内部协程判断是否有可用对象，没有时根据WhenExhausted返回ErrExhausted或创建新对象
+func (m *TypedRecyclePool[T]) tryBorrow() (T, error) {
+    reply := make(chan tryResult[T], 1)
+    select {
+    case m.try <- reply:
+    case <-m.closing:
+        var zero T
+        return zero, gomem.ErrClosed
+    }
+    ret := <-reply
+    if ret.ok {
+        return m.checkObj(ret.obj)
+    }
+    select {
+    case <-m.closing:
+        return ret.obj, gomem.ErrClosed
+    default:
+    }
+    if m.WhenExhausted == WhenExhaustedNew {
+        o, err := m.checkObj(m.create())
+        if err == nil {
+            m.stats.Borrowed.Add(1)
+        }
+        return o, err
+    }
+    return ret.obj, gomem.ErrExhausted
+}
+
+func (m *TypedRecyclePool[T]) checkObj(o T) (T, error) {
+    if objutil.IsNil(o) {
+        return o, gomem.ErrFactory
+    }
+    return o, nil
+}
+
+//对象池关闭后归还的对象将被直接释放
+func (m *TypedRecyclePool[T]) Put(i T) {
+    if m.lazyInit() != nil {
+        return
+    }
+    if m.Strict {
+        if err := m.strict.Return(i, false); err != nil {
+            panic(fmt.Errorf("recyclePool: put %T: %w", i, err))
+        }
+    }
+    if m.DetectLeaks {
+        m.leaks.Return(i)
+    }
+    if m.PoisonOnReturn {
+        strict.Poison(i)
+    }
+    select {
+    case m.give <- i:
+    case <-m.stop:
+        m.stats.Returned.Add(1)
+        m.delete(i)
+    }
+}
+
+//返回对象池的统计信息，可与借用、归还并发调用。只有设置EvictionPolicy或MaxLifetime跟踪借出的对象时才统计ActiveTime；
+//对象池关闭后空闲对象数量为0
+func (m *TypedRecyclePool[T]) Stats() gomem.PoolStats {
+    idle := 0
+    if m.lazyInit() == nil {
+        reply := make(chan int, 1)
+        select {
+        case m.idle <- reply:
+            idle = <-reply
+        case <-m.stop:
+        }
+    }
+    s := m.stats.Snapshot(idle, int(atomic.LoadInt32(&m.borrowed)), int(atomic.LoadInt32(&m.waiters)))
+    s.DroppedEvents = m.events.Dropped()
+    return s
+}
+
+//添加生命周期监听器，可在任意时刻调用，见gomem.TypedPoolListener
+func (m *TypedRecyclePool[T]) AddListener(l gomem.TypedPoolListener[T]) {
+    m.events.Add(l)
+}
+
+//成功借出时记录等待时间，超时时计数，并通知借出或超时事件
+func (m *TypedRecyclePool[T]) recordBorrow(start time.Time, o T, err error) {
+    wait := time.Since(start)
+    if err == nil {
+        if m.Strict {
+            m.strict.Borrow(o)
+        }
+        if m.DetectLeaks {
+            m.leaks.Borrow(o)
+        }
+        m.stats.BorrowWait.Observe(wait)
+        m.events.Emit(gomem.EventBorrow, o, gomem.IDLE, wait)
+        return
+    }
+    if stats.IsTimeout(err) {
+        m.stats.Timeouts.Add(1)
+        m.events.Emit(gomem.EventTimeout, o, -1, wait)
+    }
+}
+
+//借出对象并返回其句柄，调用句柄的Release归还对象。DetectLeaks为true时句柄未Release即被垃圾回收将记录日志
+func (m *TypedRecyclePool[T]) BorrowHandle() (*gomem.TypedHandle[T], error) {
+    o, err := m.Borrow()
+    if err != nil {
+        return nil, err
+    }
+    if !m.DetectLeaks {
+        return gomem.NewTypedHandle(o, m.Put), nil
+    }
+    return m.leaks.Handle("recyclePool", o, m.Put), nil
+}
+
+//借出超过LeakThreshold仍未归还的对象及其借出时的调用栈，按借出时间排序。DetectLeaks为false时返回nil
+func (m *TypedRecyclePool[T]) Leaks() []gomem.TypedLeakInfo[T] {
+    if !m.DetectLeaks {
+        return nil
+    }
+    return m.leaks.Leaks(m.LeakThreshold)
 }
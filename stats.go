@@ -0,0 +1,70 @@
+/**
+ * Copyright (C) 2019, Xiongfa Li.
+ * All right reserved.
+ * @author xiongfa.li
+ * @date 2019/3/20
+ * @time 10:15
+ * @version V1.0
+ * Description: 
+ */
+
+package gomem
+
+import "time"
+
+//对象池统计信息的快照，由各对象池的Stats方法返回。计数器自对象池初始化起累计
+type PoolStats struct {
+    //创建成功的对象数量
+    Created int64
+    //销毁（释放）的对象数量
+    Destroyed int64
+    //借出的对象数量
+    Borrowed int64
+    //归还的对象数量
+    Returned int64
+    //创建、借出、归还或空闲检测时验证失败的次数
+    ValidationFailures int64
+    //因回收策略或超过MaxLifetime被移除的对象数量
+    Evicted int64
+    //借用者等待超时的次数，包括ctx超过截止时间
+    Timeouts int64
+    //因监听器处理缓慢被丢弃的生命周期事件数量
+    DroppedEvents int64
+
+    //当前空闲对象数量
+    Idle int
+    //当前借出的对象数量
+    Active int
+    //当前等待获取对象的借用者数量
+    Waiting int
+
+    //借用者成功获得对象前的等待时间
+    BorrowWait DurationHistogram
+    //对象从借出到归还的时间
+    ActiveTime DurationHistogram
+}
+
+//时间分布。Counts[i]为大于Bounds[i-1]且不超过Bounds[i]的记录数，最后一个为超过所有边界的记录数，因此Counts比Bounds多一个
+type DurationHistogram struct {
+    Bounds []time.Duration
+    Counts []int64
+    //记录总数
+    Count int64
+    //记录的时间总和
+    Sum time.Duration
+    //记录的最大时间
+    Max time.Duration
+}
+
+//平均时间，没有记录时返回0
+func (h DurationHistogram) Mean() time.Duration {
+    if h.Count == 0 {
+        return 0
+    }
+    return h.Sum / time.Duration(h.Count)
+}
+
+//提供统计信息的对象池，内置的对象池均实现了该接口
+type StatsProvider interface {
+    Stats() PoolStats
+}
@@ -12,8 +12,14 @@ package test
 
 import (
     "container/list"
+    "context"
+    "errors"
     "fmt"
+    "github.com/xfali/gomem"
+    "github.com/xfali/gomem/commonPool"
     commonPool2 "github.com/xfali/gomem/commonPool2"
+    "sync"
+    "sync/atomic"
     "testing"
     "time"
 )
@@ -159,3 +165,1116 @@ func TestCommonPool2_subloopTimeout(t *testing.T) {
     time.Sleep(10 * time.Second)
     fmt.Printf("%d ms\n", time.Since(now)/time.Millisecond)
 }
+
+func TestCommonPool2_getContext(t *testing.T) {
+    f := b(1)
+    pb := commonPool2.CommonPool{
+        MinIdle:            1,
+        MaxSize:            1,
+        BlockWhenExhausted: true,
+        Factory:            &f,
+        MaxWaitMillis:      time.Second,
+    }
+    pb.Init()
+    defer pb.Close()
+
+    buf, err := pb.GetContext(context.Background())
+    if err != nil {
+        t.Fatal(err)
+    }
+
+    ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+    defer cancel()
+    now := time.Now()
+    _, err = pb.GetContext(ctx)
+    if err != context.DeadlineExceeded {
+        t.Fatalf("expect DeadlineExceeded but got %v", err)
+    }
+    fmt.Printf("use time :%d ms\n", time.Since(now)/time.Millisecond)
+
+    pb.Put(buf)
+    buf, err = pb.GetContext(context.Background())
+    if err != nil {
+        t.Fatal(err)
+    }
+    fmt.Printf("value %v\n", buf)
+}
+
+func TestCommonPool2_borrow(t *testing.T) {
+    f := b(1)
+    pb := commonPool2.CommonPool{
+        MinIdle:       1,
+        MaxSize:       1,
+        Factory:       &f,
+        MaxWaitMillis: 100 * time.Millisecond,
+    }
+    pb.Init()
+
+    buf, err := pb.Borrow()
+    if err != nil {
+        t.Fatal(err)
+    }
+    _, err = pb.Borrow()
+    if !errors.Is(err, gomem.ErrExhausted) {
+        t.Fatalf("expect ErrExhausted but got %v", err)
+    }
+
+    //配置在初始化后不能修改，阻塞等待使用另一个对象池
+    blocking := commonPool2.CommonPool{
+        MaxSize:            1,
+        BlockWhenExhausted: true,
+        Factory:            &f,
+        MaxWaitMillis:      100 * time.Millisecond,
+    }
+    defer blocking.Close()
+    blocking.Get()
+    _, err = blocking.Borrow()
+    if !errors.Is(err, gomem.ErrTimeout) {
+        t.Fatalf("expect ErrTimeout but got %v", err)
+    }
+
+    pb.Put(buf)
+    pb.Close()
+    _, err = pb.Borrow()
+    if !errors.Is(err, gomem.ErrClosed) {
+        t.Fatalf("expect ErrClosed but got %v", err)
+    }
+}
+
+func TestCommonPool2_defaultMaxWait(t *testing.T) {
+    f := b(1)
+    //未设置MaxWaitMillis时一直等待，MaxSize不受影响
+    pb := commonPool2.CommonPool{
+        MaxSize:            2,
+        BlockWhenExhausted: true,
+        Factory:            &f,
+    }
+    pb.Init()
+    defer pb.Close()
+
+    b1, err := pb.Borrow()
+    if err != nil {
+        t.Fatal(err)
+    }
+    if _, err := pb.Borrow(); err != nil {
+        t.Fatal(err)
+    }
+    go func() {
+        time.Sleep(50 * time.Millisecond)
+        pb.Put(b1)
+    }()
+    if _, err := pb.Borrow(); err != nil {
+        t.Fatal(err)
+    }
+}
+
+func TestCommonPool2_borrowValidationFailed(t *testing.T) {
+    pb := commonPool2.CommonPool{
+        MaxSize:            1,
+        BlockWhenExhausted: true,
+        MaxWaitMillis:      100 * time.Millisecond,
+        TestOnBorrow:       true,
+        Factory: &commonPool2.DefaultFactory{
+            Make:     func() interface{} { return "test" },
+            Validate: func(interface{}) bool { return false },
+        },
+    }
+    pb.Init()
+    defer pb.Close()
+
+    for i := 0; i < 3; i++ {
+        _, err := pb.Borrow()
+        if !errors.Is(err, gomem.ErrValidationFailed) {
+            t.Fatalf("expect ErrValidationFailed but got %v", err)
+        }
+    }
+}
+
+func TestCommonPool2_typed(t *testing.T) {
+    var pb gomem.TypedPool[[]byte] = &commonPool2.TypedCommonPool[[]byte]{
+        MaxSize:            2,
+        BlockWhenExhausted: true,
+        MaxWaitMillis:      time.Second,
+        Factory: &commonPool2.TypedDefaultFactory[[]byte]{
+            Make: func() []byte { return make([]byte, 1000) },
+        },
+    }
+    pb.Init()
+    defer pb.Close()
+
+    buf, err := pb.Borrow()
+    if err != nil {
+        t.Fatal(err)
+    }
+    if len(buf) != 1000 {
+        t.Fatalf("expect 1000 bytes but got %d", len(buf))
+    }
+    pb.Put(buf)
+}
+
+type fallible struct {
+    makeErr     int
+    activateErr int
+}
+
+func (f *fallible) ActivateObject(i interface{}) error {
+    if f.activateErr > 0 {
+        f.activateErr--
+        return errors.New("activate failed")
+    }
+    return nil
+}
+func (f *fallible) DestroyObject(i interface{}) { fmt.Printf("DestroyObject %v\n", i) }
+func (f *fallible) MakeObject() (interface{}, error) {
+    if f.makeErr > 0 {
+        f.makeErr--
+        return nil, errors.New("make failed")
+    }
+    return "test", nil
+}
+func (f *fallible) PassivateObject(i interface{}) error { return nil }
+func (f *fallible) ValidateObject(i interface{}) bool   { return true }
+
+func TestCommonPool2_fallibleFactory(t *testing.T) {
+    pb := commonPool2.CommonPool{
+        MaxSize:            1,
+        BlockWhenExhausted: true,
+        MaxWaitMillis:      100 * time.Millisecond,
+        FallibleFactory:    &fallible{makeErr: 2, activateErr: 1},
+    }
+    pb.Init()
+    defer pb.Close()
+
+    //两次创建失败，一次激活失败，均不占用MaxSize名额
+    for i := 0; i < 3; i++ {
+        _, err := pb.Borrow()
+        if !errors.Is(err, gomem.ErrFactory) {
+            t.Fatalf("expect ErrFactory but got %v", err)
+        }
+        fmt.Println(err)
+    }
+    buf, err := pb.Borrow()
+    if err != nil {
+        t.Fatal(err)
+    }
+    fmt.Printf("value %v\n", buf)
+}
+
+func TestCommonPool2_removeAbandoned(t *testing.T) {
+    count := 0
+    destroyed := 0
+    pb := commonPool2.CommonPool{
+        MaxSize:                 1,
+        BlockWhenExhausted:      true,
+        MaxWaitMillis:           time.Second,
+        RemoveAbandonedOnBorrow: true,
+        RemoveAbandonedTimeout:  100 * time.Millisecond,
+        LogAbandoned:            true,
+        Factory: &commonPool2.DefaultFactory{
+            Make: func() interface{} {
+                count++
+                return count
+            },
+            Destroy: func(i interface{}) {
+                destroyed++
+                fmt.Printf("DestroyObject %v\n", i)
+            },
+        },
+    }
+    pb.Init()
+    defer pb.Close()
+
+    buf, err := pb.Borrow()
+    if err != nil {
+        t.Fatal(err)
+    }
+    time.Sleep(200 * time.Millisecond)
+
+    buf2, err := pb.Borrow()
+    if err != nil {
+        t.Fatal(err)
+    }
+    if buf == buf2 || destroyed != 1 {
+        t.Fatalf("expect abandoned object %v destroyed, got %v, destroyed %d", buf, buf2, destroyed)
+    }
+
+    //被遗弃的对象归还后将被忽略
+    pb.Put(buf)
+    pb.Put(buf2)
+    buf, err = pb.Borrow()
+    if err != nil {
+        t.Fatal(err)
+    }
+    if buf != buf2 {
+        t.Fatalf("expect %v but got %v", buf2, buf)
+    }
+}
+
+func TestCommonPool2_invalidate(t *testing.T) {
+    f := b(1)
+    pb := commonPool2.CommonPool{
+        MaxSize:            2,
+        BlockWhenExhausted: true,
+        MaxWaitMillis:      100 * time.Millisecond,
+        Factory:            &f,
+    }
+    pb.Init()
+    defer pb.Close()
+
+    buf, err := pb.Borrow()
+    if err != nil {
+        t.Fatal(err)
+    }
+    if pb.NumActive() != 1 {
+        t.Fatalf("expect 1 active but got %d", pb.NumActive())
+    }
+    if err := pb.InvalidateObject(buf); err != nil {
+        t.Fatal(err)
+    }
+    if err := pb.InvalidateObject(buf); !errors.Is(err, gomem.ErrUnknownObject) {
+        t.Fatalf("expect ErrUnknownObject but got %v", err)
+    }
+    if pb.NumActive() != 0 {
+        t.Fatalf("expect 0 active but got %d", pb.NumActive())
+    }
+
+    //被销毁的对象不再占用MaxSize名额
+    if err := pb.AddObject(); err != nil {
+        t.Fatal(err)
+    }
+    if pb.NumIdle() != 2 {
+        t.Fatalf("expect 2 idle but got %d", pb.NumIdle())
+    }
+    if err := pb.AddObject(); !errors.Is(err, gomem.ErrExhausted) {
+        t.Fatalf("expect ErrExhausted but got %v", err)
+    }
+
+    if err := pb.Clear(); err != nil {
+        t.Fatal(err)
+    }
+    fmt.Printf("idle %d active %d waiters %d\n", pb.NumIdle(), pb.NumActive(), pb.NumWaiters())
+}
+
+type uncomparable struct {
+    id  int
+    buf []byte
+}
+
+func TestCommonPool2_uncomparable(t *testing.T) {
+    id := 0
+    destroyed := -1
+    pb := commonPool2.TypedCommonPool[uncomparable]{
+        MaxSize:            3,
+        Lifo:               true,
+        BlockWhenExhausted: true,
+        MaxWaitMillis:      100 * time.Millisecond,
+        Factory: &commonPool2.TypedDefaultFactory[uncomparable]{
+            Make: func() uncomparable {
+                id++
+                return uncomparable{id, make([]byte, 8)}
+            },
+            Destroy: func(o uncomparable) { destroyed = o.id },
+        },
+    }
+    pb.Init()
+    defer pb.Close()
+
+    a, _ := pb.Borrow()
+    b, _ := pb.Borrow()
+    pb.Put(a)
+    //归还的是a，再次借出的也必须是a，而不是仍被借出的b
+    c, err := pb.Borrow()
+    if err != nil {
+        t.Fatal(err)
+    }
+    if c.id != a.id {
+        t.Fatalf("expect object %d but got %d", a.id, c.id)
+    }
+    if err := pb.InvalidateObject(c); err != nil {
+        t.Fatal(err)
+    }
+    if destroyed != a.id {
+        t.Fatalf("expect object %d destroyed but got %d", a.id, destroyed)
+    }
+    if pb.NumActive() != 1 {
+        t.Fatalf("expect 1 active but got %d", pb.NumActive())
+    }
+    pb.Put(b)
+}
+
+//类型可比较，但接口字段中的值不可比较
+type boxed struct {
+    X interface{}
+}
+
+func TestCommonPool2_unhashableField(t *testing.T) {
+    pb := commonPool2.TypedCommonPool[boxed]{
+        MaxSize:            2,
+        Lifo:               true,
+        BlockWhenExhausted: true,
+        MaxWaitMillis:      100 * time.Millisecond,
+        Strict:             true,
+        Factory: &commonPool2.TypedDefaultFactory[boxed]{
+            Make: func() boxed { return boxed{X: []byte{1}} },
+        },
+    }
+    pb.Init()
+    defer pb.Close()
+
+    a, err := pb.Borrow()
+    if err != nil {
+        t.Fatal(err)
+    }
+    pb.Put(a)
+    if _, err := pb.Borrow(); err != nil {
+        t.Fatal(err)
+    }
+
+    cp := commonPool.TypedCommonPool[boxed]{
+        MaxLifetime: time.Hour,
+        DetectLeaks: true,
+        New:         func() boxed { return boxed{X: []byte{1}} },
+    }
+    defer cp.Close()
+    cp.Put(cp.Get())
+}
+
+type conn struct {
+    Uses int
+}
+
+func TestCommonPool2_modifiedValue(t *testing.T) {
+    pb := commonPool2.TypedCommonPool[conn]{
+        MaxSize:            1,
+        BlockWhenExhausted: true,
+        MaxWaitMillis:      100 * time.Millisecond,
+        Factory: &commonPool2.TypedDefaultFactory[conn]{
+            Make: func() conn { return conn{} },
+        },
+    }
+    pb.Init()
+    defer pb.Close()
+
+    //借出后被修改的值类型对象仍然作为借出的对象归还，不会一直占用MaxSize名额
+    c, err := pb.Borrow()
+    if err != nil {
+        t.Fatal(err)
+    }
+    c.Uses++
+    pb.Put(c)
+    if c, err = pb.Borrow(); err != nil {
+        t.Fatal(err)
+    }
+    if c.Uses != 1 {
+        t.Fatalf("expect the returned object but got %v", c)
+    }
+    pb.Put(c)
+    if pb.NumActive() != 0 {
+        t.Fatalf("expect 0 active but got %d", pb.NumActive())
+    }
+}
+
+func TestCommonPool2_testWhileIdle(t *testing.T) {
+    var destroyed int32
+    pb := commonPool2.CommonPool{
+        MinIdle:                       4,
+        MaxSize:                       4,
+        BlockWhenExhausted:            true,
+        TimeBetweenEvictionRunsMillis: 100 * time.Millisecond,
+        NumTestsPerEvictionRun:        -2,
+        TestWhileIdle:                 true,
+        Factory: &commonPool2.DefaultFactory{
+            Make:     func() interface{} { return make([]byte, 10) },
+            Validate: func(interface{}) bool { return false },
+            Destroy: func(i interface{}) {
+                fmt.Printf("DestroyObject %p\n", i)
+                atomic.AddInt32(&destroyed, 1)
+            },
+        },
+    }
+    pb.Init()
+    defer pb.Close()
+
+    l := list.New()
+    for i := 0; i < 4; i++ {
+        l.PushBack(pb.Get())
+    }
+    for e := l.Front(); e != nil; e = e.Next() {
+        pb.Put(e.Value)
+    }
+
+    //每次检查4/2=2个对象，销毁后重新补充到MinIdle
+    time.Sleep(250 * time.Millisecond)
+    if n := atomic.LoadInt32(&destroyed); n != 4 {
+        t.Fatalf("expect 4 destroyed but got %d", n)
+    }
+    if pb.NumIdle() != 4 {
+        t.Fatalf("expect 4 idle but got %d", pb.NumIdle())
+    }
+}
+
+func TestCommonPool2_evictionRoundRobin(t *testing.T) {
+    //5个空闲对象，每次检查2个或5/2向上取整即3个，下次从上次结束的位置继续
+    checkEvictionRuns(t, 2, [][]int{{1, 2}, {1, 2, 3, 4}, {1, 2, 3, 4, 5, 1}})
+    checkEvictionRuns(t, -2, [][]int{{1, 2, 3}, {1, 2, 3, 4, 5, 1}, {1, 2, 3, 4, 5, 1, 2, 3, 4}})
+}
+
+//按顺序记录每次回收检查时验证的对象，在每次检查后与expect比较
+func checkEvictionRuns(t *testing.T, numTests int, expect [][]int) {
+    var mutex sync.Mutex
+    var visited []int
+    id := 0
+    pb := commonPool2.TypedCommonPool[*int]{
+        MinIdle:                       5,
+        MaxSize:                       5,
+        TimeBetweenEvictionRunsMillis: 100 * time.Millisecond,
+        NumTestsPerEvictionRun:        numTests,
+        TestWhileIdle:                 true,
+        Factory: &commonPool2.TypedDefaultFactory[*int]{
+            Make: func() *int {
+                id++
+                v := id
+                return &v
+            },
+            Validate: func(i *int) bool {
+                mutex.Lock()
+                defer mutex.Unlock()
+                visited = append(visited, *i)
+                return true
+            },
+        },
+    }
+    pb.Init()
+    defer pb.Close()
+    //内部协程可能已预先创建了第一个对象
+    for pb.AddObject() == nil {
+    }
+    if pb.NumIdle() != 5 {
+        t.Fatalf("expect 5 idle but got %d", pb.NumIdle())
+    }
+
+    time.Sleep(50 * time.Millisecond)
+    for run, want := range expect {
+        time.Sleep(100 * time.Millisecond)
+        mutex.Lock()
+        got := fmt.Sprint(visited)
+        mutex.Unlock()
+        if got != fmt.Sprint(want) {
+            t.Fatalf("NumTestsPerEvictionRun %d run %d: expect %v but got %v", numTests, run+1, want, got)
+        }
+    }
+}
+
+func TestCommonPool2_maxLifetime(t *testing.T) {
+    destroyed := 0
+    pb := commonPool2.CommonPool{
+        MaxSize:            1,
+        BlockWhenExhausted: true,
+        MaxWaitMillis:      100 * time.Millisecond,
+        MaxLifetime:        100 * time.Millisecond,
+        Factory: &commonPool2.DefaultFactory{
+            Make:    func() interface{} { return make([]byte, 10) },
+            Destroy: func(i interface{}) { destroyed++ },
+        },
+    }
+    pb.Init()
+    defer pb.Close()
+
+    buf := pb.Get()
+    time.Sleep(150 * time.Millisecond)
+    //归还时已过期，对象被销毁并释放名额
+    pb.Put(buf)
+
+    buf2, err := pb.Borrow()
+    if err != nil {
+        t.Fatal(err)
+    }
+    if fmt.Sprintf("%p", buf) == fmt.Sprintf("%p", buf2) {
+        t.Fatal("expired object must not be borrowed again")
+    }
+    pb.Put(buf2)
+    time.Sleep(150 * time.Millisecond)
+    //空闲期间过期的对象不会被借出
+    buf3, err := pb.Borrow()
+    if err != nil {
+        t.Fatal(err)
+    }
+    if fmt.Sprintf("%p", buf2) == fmt.Sprintf("%p", buf3) {
+        t.Fatal("expired idle object must not be borrowed")
+    }
+    pb.Put(buf3)
+    if pb.Clear() != nil || destroyed != 3 {
+        t.Fatalf("expect 3 destroyed but got %d", destroyed)
+    }
+}
+
+func TestCommonPool2_fairness(t *testing.T) {
+    pb := commonPool2.CommonPool{
+        MaxSize:            1,
+        BlockWhenExhausted: true,
+        MaxWaitMillis:      time.Second,
+        Fairness:           true,
+        Factory: &commonPool2.DefaultFactory{
+            Make: func() interface{} { return new(int) },
+        },
+    }
+    pb.Init()
+    defer pb.Close()
+
+    buf := pb.Get()
+    order := make(chan int, 5)
+    for i := 0; i < 5; i++ {
+        go func(i int) {
+            o, err := pb.Borrow()
+            if err != nil {
+                t.Error(err)
+                return
+            }
+            order <- i
+            pb.Put(o)
+        }(i)
+        //保证到达顺序
+        time.Sleep(20 * time.Millisecond)
+    }
+    pb.Put(buf)
+    for i := 0; i < 5; i++ {
+        if v := <-order; v != i {
+            t.Fatalf("expect waiter %d but got %d", i, v)
+        }
+    }
+}
+
+func TestCommonPool2_fairnessTimeout(t *testing.T) {
+    pb := commonPool2.CommonPool{
+        MaxSize:            1,
+        BlockWhenExhausted: true,
+        MaxWaitMillis:      100 * time.Millisecond,
+        Fairness:           true,
+        Factory: &commonPool2.DefaultFactory{
+            Make: func() interface{} { return new(int) },
+        },
+    }
+    pb.Init()
+    defer pb.Close()
+
+    buf := pb.Get()
+    now := time.Now()
+    if _, err := pb.Borrow(); !errors.Is(err, gomem.ErrTimeout) {
+        t.Fatalf("expect ErrTimeout but got %v", err)
+    }
+    fmt.Printf("timeout after %d ms\n", time.Since(now)/time.Millisecond)
+
+    ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+    defer cancel()
+    if _, err := pb.GetContext(ctx); !errors.Is(err, context.DeadlineExceeded) {
+        t.Fatalf("expect DeadlineExceeded but got %v", err)
+    }
+
+    //已超时、已放弃的等待者不会获得对象
+    pb.Put(buf)
+    o, err := pb.Borrow()
+    if err != nil {
+        t.Fatal(err)
+    }
+    if o != buf {
+        t.Fatalf("expect %p but got %p", buf, o)
+    }
+    if pb.NumWaiters() != 0 {
+        t.Fatalf("expect 0 waiters but got %d", pb.NumWaiters())
+    }
+}
+
+func TestCommonPool2_priority(t *testing.T) {
+    pb := commonPool2.CommonPool{
+        MaxSize:            1,
+        BlockWhenExhausted: true,
+        Factory: &commonPool2.DefaultFactory{
+            Make: func() interface{} { return new(int) },
+        },
+    }
+    pb.Init()
+    defer pb.Close()
+
+    buf := pb.Get()
+    order := make(chan int, 4)
+    for _, prio := range []int{0, 1, 5, 1} {
+        go func(prio int) {
+            o, err := pb.GetWithPriority(context.Background(), prio)
+            if err != nil {
+                t.Error(err)
+                return
+            }
+            order <- prio
+            pb.Put(o)
+        }(prio)
+        time.Sleep(20 * time.Millisecond)
+    }
+    pb.Put(buf)
+    for _, expect := range []int{5, 1, 1, 0} {
+        if v := <-order; v != expect {
+            t.Fatalf("expect priority %d but got %d", expect, v)
+        }
+    }
+}
+
+func TestCommonPool2_negativePriority(t *testing.T) {
+    pb := commonPool2.CommonPool{
+        MaxSize:            1,
+        BlockWhenExhausted: true,
+        Factory: &commonPool2.DefaultFactory{
+            Make: func() interface{} { return new(int) },
+        },
+    }
+    pb.Init()
+    defer pb.Close()
+
+    buf := pb.Get()
+    order := make(chan int, 2)
+    go func() {
+        o, err := pb.GetWithPriority(context.Background(), -5)
+        if err != nil {
+            t.Error(err)
+            return
+        }
+        order <- -5
+        pb.Put(o)
+    }()
+    time.Sleep(20 * time.Millisecond)
+    go func() {
+        o := pb.Get()
+        order <- 0
+        pb.Put(o)
+    }()
+    time.Sleep(20 * time.Millisecond)
+    //不带优先级的借用者优先级为0，先于优先级为负数的等待者
+    pb.Put(buf)
+    for _, expect := range []int{0, -5} {
+        if v := <-order; v != expect {
+            t.Fatalf("expect priority %d but got %d", expect, v)
+        }
+    }
+}
+
+func TestCommonPool2_reservedCapacity(t *testing.T) {
+    pb := commonPool2.CommonPool{
+        MaxSize:          2,
+        ReservedCapacity: 1,
+        ReservedPriority: 0,
+        Factory: &commonPool2.DefaultFactory{
+            Make: func() interface{} { return new(int) },
+        },
+    }
+    pb.Init()
+    defer pb.Close()
+
+    buf, err := pb.Borrow()
+    if err != nil {
+        t.Fatal(err)
+    }
+    //最后一个对象为优先级高于0的借用者保留
+    if _, err := pb.Borrow(); !errors.Is(err, gomem.ErrExhausted) {
+        t.Fatalf("expect ErrExhausted but got %v", err)
+    }
+    ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+    defer cancel()
+    if _, err := pb.GetWithPriority(ctx, 0); !errors.Is(err, context.DeadlineExceeded) {
+        t.Fatalf("expect DeadlineExceeded but got %v", err)
+    }
+    buf2, err := pb.GetWithPriority(context.Background(), 1)
+    if err != nil {
+        t.Fatal(err)
+    }
+    pb.Put(buf2)
+    pb.Put(buf)
+}
+
+func TestCommonPool2_prewarm(t *testing.T) {
+    var made int32
+    pb := commonPool2.CommonPool{
+        MinIdle:                       4,
+        MaxSize:                       8,
+        MinEvictableIdleTimeMillis:    50 * time.Millisecond,
+        TimeBetweenEvictionRunsMillis: 100 * time.Millisecond,
+        NumTestsPerEvictionRun:        -1,
+        EvictionPolicy: gomem.EvictionPolicyFunc(func(config *gomem.EvictionConfig, info *gomem.PooledObjectInfo, idleCount int) bool {
+            return time.Since(info.IdleSince()) > config.MinEvictableIdleTime
+        }),
+        Factory: &commonPool2.DefaultFactory{
+            Make: func() interface{} {
+                atomic.AddInt32(&made, 1)
+                return new(int)
+            },
+        },
+    }
+    pb.Init()
+    defer pb.Close()
+
+    if err := pb.Prewarm(context.Background()); err != nil {
+        t.Fatal(err)
+    }
+    if pb.NumIdle() != 4 {
+        t.Fatalf("expect 4 idle but got %d", pb.NumIdle())
+    }
+
+    //所有空闲对象被回收后重新补充到MinIdle
+    time.Sleep(150 * time.Millisecond)
+    if pb.NumIdle() != 4 {
+        t.Fatalf("expect 4 idle but got %d", pb.NumIdle())
+    }
+    if n := atomic.LoadInt32(&made); n != 8 {
+        t.Fatalf("expect 8 made but got %d", n)
+    }
+
+    failed := commonPool2.CommonPool{
+        MinIdle: 2,
+        FallibleFactory: &fallible{makeErr: 5},
+    }
+    failed.Init()
+    defer failed.Close()
+    if err := failed.Prewarm(context.Background()); !errors.Is(err, gomem.ErrFactory) {
+        t.Fatalf("expect ErrFactory but got %v", err)
+    }
+}
+
+func TestCommonPool2_asyncCreate(t *testing.T) {
+    var made int32
+    pb := commonPool2.CommonPool{
+        MaxSize:              4,
+        BlockWhenExhausted:   true,
+        MaxWaitMillis:        time.Second,
+        MaxConcurrentCreates: 4,
+        Factory: &commonPool2.DefaultFactory{
+            Make: func() interface{} {
+                atomic.AddInt32(&made, 1)
+                time.Sleep(100 * time.Millisecond)
+                return new(int)
+            },
+        },
+    }
+    pb.Init()
+    defer pb.Close()
+
+    now := time.Now()
+    results := make(chan interface{}, 6)
+    for i := 0; i < 6; i++ {
+        go func() {
+            o, err := pb.Borrow()
+            if err != nil {
+                t.Error(err)
+            }
+            results <- o
+        }()
+    }
+    //创建对象不阻塞内部协程
+    time.Sleep(10 * time.Millisecond)
+    pb.NumIdle()
+    if d := time.Since(now); d > 50*time.Millisecond {
+        t.Fatalf("pool loop blocked for %d ms", d/time.Millisecond)
+    }
+
+    bufs := make([]interface{}, 0, 4)
+    for i := 0; i < 4; i++ {
+        bufs = append(bufs, <-results)
+    }
+    fmt.Printf("4 objects created in %d ms\n", time.Since(now)/time.Millisecond)
+    if d := time.Since(now); d > 300*time.Millisecond {
+        t.Fatalf("expect concurrent creation but took %d ms", d/time.Millisecond)
+    }
+    //正在创建的对象占用MaxSize名额
+    if n := atomic.LoadInt32(&made); n != 4 {
+        t.Fatalf("expect 4 made but got %d", n)
+    }
+    for _, o := range bufs {
+        pb.Put(o)
+    }
+    pb.Put(<-results)
+    pb.Put(<-results)
+}
+
+//failing为true时创建失败
+type flaky struct {
+    failing int32
+    made    int32
+}
+
+func (f *flaky) ActivateObject(i interface{}) error { return nil }
+func (f *flaky) DestroyObject(i interface{})        {}
+func (f *flaky) MakeObject() (interface{}, error) {
+    atomic.AddInt32(&f.made, 1)
+    if atomic.LoadInt32(&f.failing) > 0 {
+        atomic.AddInt32(&f.failing, -1)
+        return nil, errors.New("backend down")
+    }
+    return new(int), nil
+}
+func (f *flaky) PassivateObject(i interface{}) error { return nil }
+func (f *flaky) ValidateObject(i interface{}) bool   { return true }
+
+func TestCommonPool2_asyncCreateNonBlocking(t *testing.T) {
+    pb := commonPool2.CommonPool{
+        MaxSize:              1,
+        MaxWaitMillis:        time.Second,
+        MaxConcurrentCreates: 1,
+        Factory: &commonPool2.DefaultFactory{
+            Make: func() interface{} {
+                time.Sleep(50 * time.Millisecond)
+                return new(int)
+            },
+        },
+    }
+    pb.Init()
+    defer pb.Close()
+
+    //未达到MaxSize时等待后台创建完成，而不是返回ErrExhausted
+    o, err := pb.Borrow()
+    if err != nil {
+        t.Fatal(err)
+    }
+    now := time.Now()
+    if _, err := pb.Borrow(); !errors.Is(err, gomem.ErrExhausted) {
+        t.Fatalf("expect ErrExhausted but got %v", err)
+    }
+    if time.Since(now) > 20*time.Millisecond {
+        t.Fatal("expect return immediately when MaxSize reached")
+    }
+    pb.Put(o)
+}
+
+func TestCommonPool2_createRetry(t *testing.T) {
+    f := &flaky{failing: 3}
+    pb := commonPool2.CommonPool{
+        BlockWhenExhausted: true,
+        MaxWaitMillis:      time.Second,
+        CreateRetries:      3,
+        CreateRetryBackoff: 10 * time.Millisecond,
+        FallibleFactory:    f,
+    }
+    pb.Init()
+    defer pb.Close()
+
+    //重试期间继续等待，不会获得创建失败的错误
+    o, err := pb.Borrow()
+    if err != nil {
+        t.Fatal(err)
+    }
+    pb.Put(o)
+    //3次失败、1次成功，以及借出后内部协程预先创建的1个对象
+    if n := atomic.LoadInt32(&f.made); n != 5 {
+        t.Fatalf("expect 5 made but got %d", n)
+    }
+}
+
+func TestCommonPool2_circuitBreaker(t *testing.T) {
+    f := &flaky{failing: 1 << 20}
+    pb := commonPool2.CommonPool{
+        BreakerThreshold: 3,
+        BreakerCooldown:  200 * time.Millisecond,
+        FallibleFactory:  f,
+    }
+    pb.Init()
+    defer pb.Close()
+
+    for i := 0; i < 3; i++ {
+        if _, err := pb.Borrow(); !errors.Is(err, gomem.ErrFactory) {
+            t.Fatalf("expect ErrFactory but got %v", err)
+        }
+    }
+    //熔断期间立即失败，不再调用工厂
+    for i := 0; i < 3; i++ {
+        if _, err := pb.Borrow(); !errors.Is(err, gomem.ErrCircuitOpen) {
+            t.Fatalf("expect ErrCircuitOpen but got %v", err)
+        }
+    }
+    if n := atomic.LoadInt32(&f.made); n != 3 {
+        t.Fatalf("expect 3 made but got %d", n)
+    }
+
+    //熔断结束后试探创建成功，恢复正常
+    atomic.StoreInt32(&f.failing, 0)
+    time.Sleep(250 * time.Millisecond)
+    o, err := pb.Borrow()
+    if err != nil {
+        t.Fatal(err)
+    }
+    pb.Put(o)
+}
+
+func TestCommonPool2_shutdown(t *testing.T) {
+    var destroyed int32
+    pb := commonPool2.CommonPool{
+        MaxSize:            3,
+        BlockWhenExhausted: true,
+        Factory: &commonPool2.DefaultFactory{
+            Make:    func() interface{} { return new(int) },
+            Destroy: func(i interface{}) { atomic.AddInt32(&destroyed, 1) },
+        },
+    }
+    pb.Init()
+
+    b1 := pb.Get()
+    b2 := pb.Get()
+    //阻塞等待的借用者在关闭时获得ErrClosed
+    b3 := pb.Get()
+    waitErr := make(chan error, 1)
+    go func() {
+        _, err := pb.Borrow()
+        waitErr <- err
+    }()
+    go func() {
+        time.Sleep(50 * time.Millisecond)
+        pb.Put(b1)
+    }()
+
+    ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+    defer cancel()
+    pb.Put(b3)
+    n, err := pb.Shutdown(ctx)
+    if n != 1 || !errors.Is(err, context.DeadlineExceeded) {
+        t.Fatalf("expect 1 outstanding but got %d, %v", n, err)
+    }
+    if err := <-waitErr; !errors.Is(err, gomem.ErrClosed) {
+        t.Fatalf("expect ErrClosed but got %v", err)
+    }
+    if _, err := pb.Borrow(); !errors.Is(err, gomem.ErrClosed) {
+        t.Fatalf("expect ErrClosed but got %v", err)
+    }
+    //关闭后归还的对象直接销毁，Put不会阻塞
+    pb.Put(b2)
+    if n := atomic.LoadInt32(&destroyed); n != 3 {
+        t.Fatalf("expect 3 destroyed but got %d", n)
+    }
+    if _, err := pb.Shutdown(context.Background()); !errors.Is(err, gomem.ErrClosed) {
+        t.Fatalf("expect ErrClosed but got %v", err)
+    }
+    pb.Close()
+}
+
+func TestCommonPool2_new(t *testing.T) {
+    _, err := commonPool2.NewCommonPool(&commonPool2.CommonPool{})
+    if !errors.Is(err, gomem.ErrInvalidConfig) {
+        t.Fatalf("expect ErrInvalidConfig but got %v", err)
+    }
+    _, err = commonPool2.NewCommonPool(&commonPool2.CommonPool{
+        Factory:          &commonPool2.DefaultFactory{},
+        MaxSize:          2,
+        ReservedCapacity: 3,
+    })
+    if !errors.Is(err, gomem.ErrInvalidConfig) {
+        t.Fatalf("expect ErrInvalidConfig but got %v", err)
+    }
+    //未设置MaxSize时按默认的MaxSize检查
+    _, err = commonPool2.NewCommonPool(&commonPool2.CommonPool{
+        Factory:          &commonPool2.DefaultFactory{},
+        ReservedCapacity: 40,
+    })
+    if !errors.Is(err, gomem.ErrInvalidConfig) {
+        t.Fatalf("expect ErrInvalidConfig but got %v", err)
+    }
+
+    cfg := &commonPool2.CommonPool{
+        Factory: &commonPool2.DefaultFactory{
+            Make: func() interface{} {
+                return 1
+            },
+        },
+        MinIdle: 1,
+        MaxSize: 1,
+    }
+    pb, err := commonPool2.NewCommonPool(cfg)
+    if err != nil {
+        t.Fatal(err)
+    }
+    defer pb.Close()
+    //创建后修改配置不影响对象池
+    cfg.MaxSize = 2
+    pb.Get()
+    if _, err := pb.Borrow(); !errors.Is(err, gomem.ErrExhausted) {
+        t.Fatalf("expect ErrExhausted but got %v", err)
+    }
+}
+
+func TestCommonPool2_lazyInit(t *testing.T) {
+    pb := commonPool2.TypedCommonPool[int]{
+        Factory: &commonPool2.TypedDefaultFactory[int]{
+            Make: func() int {
+                return 1
+            },
+        },
+    }
+    //未调用Init时自动初始化，并发调用Init只初始化一次
+    var wg sync.WaitGroup
+    for i := 0; i < 8; i++ {
+        wg.Add(1)
+        go func(i int) {
+            defer wg.Done()
+            if i%2 == 0 {
+                pb.Init()
+                return
+            }
+            v, err := pb.Borrow()
+            if err != nil {
+                t.Error(err)
+                return
+            }
+            pb.Put(v)
+        }(i)
+    }
+    wg.Wait()
+    if n := pb.NumActive(); n != 0 {
+        t.Fatalf("expect 0 active but got %d", n)
+    }
+    pb.Close()
+
+    empty := commonPool2.CommonPool{}
+    if err := empty.AddObject(); !errors.Is(err, gomem.ErrInvalidConfig) {
+        t.Fatalf("expect ErrInvalidConfig but got %v", err)
+    }
+    func() {
+        defer func() {
+            if r := recover(); r == nil {
+                t.Fatal("expect Init panic")
+            }
+        }()
+        empty.Init()
+    }()
+}
+
+func TestCommonPool2_stats(t *testing.T) {
+    count := 0
+    pb := commonPool2.TypedCommonPool[int]{
+        Factory: &commonPool2.TypedDefaultFactory[int]{
+            Make: func() int {
+                count++
+                return count
+            },
+        },
+        MaxSize:            2,
+        BlockWhenExhausted: true,
+        MaxWaitMillis:      20 * time.Millisecond,
+    }
+    pb.Init()
+    defer pb.Close()
+
+    o1 := pb.Get()
+    o2 := pb.Get()
+    if _, err := pb.Borrow(); !errors.Is(err, gomem.ErrTimeout) {
+        t.Fatalf("expect ErrTimeout but got %v", err)
+    }
+    st := pb.Stats()
+    fmt.Printf("stats %+v\n", st)
+    if st.Active != 2 || st.Idle != 0 || st.Timeouts != 1 || st.Borrowed != 2 {
+        t.Fatalf("unexpected stats %+v", st)
+    }
+    pb.Put(o1)
+    if err := pb.InvalidateObject(o2); err != nil {
+        t.Fatal(err)
+    }
+    st = pb.Stats()
+    fmt.Printf("stats %+v\n", st)
+    if st.Created != 2 || st.Destroyed != 1 || st.Returned != 1 || st.Active != 0 || st.Idle != 1 {
+        t.Fatalf("unexpected stats %+v", st)
+    }
+    if st.BorrowWait.Count != 2 || st.ActiveTime.Count != 1 || len(st.BorrowWait.Counts) != len(st.BorrowWait.Bounds)+1 {
+        t.Fatalf("unexpected histogram %+v %+v", st.BorrowWait, st.ActiveTime)
+    }
+}
@@ -12,7 +12,10 @@ package test
 
 import (
     "container/list"
+    "context"
+    "errors"
     "fmt"
+    "github.com/xfali/gomem"
     "github.com/xfali/gomem/commonPool"
     "testing"
     "time"
@@ -57,3 +60,208 @@ func TestCommonPool(t *testing.T) {
         l.PushBack(buf)
     }
 }
+
+func TestCommonPool_maxLifetime(t *testing.T) {
+    created := 0
+    pb := commonPool.CommonPool{
+        MaxSize:     1,
+        MaxLifetime: 100 * time.Millisecond,
+        New: func() interface{} {
+            created++
+            return make([]byte, 10)
+        },
+        WaitTimeout: 100 * time.Millisecond,
+    }
+    pb.Init()
+    defer pb.Close()
+
+    buf := pb.Get()
+    pb.Put(buf)
+    time.Sleep(150 * time.Millisecond)
+
+    //空闲对象已过期，借出时将被丢弃并创建新对象
+    buf, err := pb.Borrow()
+    if err != nil {
+        t.Fatal(err)
+    }
+    if created != 2 {
+        t.Fatalf("expect 2 created but got %d", created)
+    }
+    pb.Put(buf)
+}
+
+func TestCommonPool_shutdown(t *testing.T) {
+    pb := commonPool.CommonPool{
+        MaxSize: 2,
+        New: func() interface{} {
+            return make([]byte, 10)
+        },
+    }
+    pb.Init()
+
+    b1 := pb.Get()
+    b2 := pb.Get()
+    pb.Put(b1)
+    ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+    defer cancel()
+    n, err := pb.Shutdown(ctx)
+    if n != 1 || !errors.Is(err, context.DeadlineExceeded) {
+        t.Fatalf("expect 1 outstanding but got %d, %v", n, err)
+    }
+    if _, err := pb.Borrow(); !errors.Is(err, gomem.ErrClosed) {
+        t.Fatalf("expect ErrClosed but got %v", err)
+    }
+    pb.Put(b2)
+    pb.Close()
+}
+
+func TestCommonPool_overflow(t *testing.T) {
+    destroyed := 0
+    newPool := func(policy int) *commonPool.CommonPool {
+        pb := &commonPool.CommonPool{
+            MaxIdle:         1,
+            MaxSize:         3,
+            OverflowPolicy:  policy,
+            OverflowTimeout: 50 * time.Millisecond,
+            New: func() interface{} {
+                return make([]byte, 10)
+            },
+            Destroy: func(i interface{}) {
+                destroyed++
+            },
+        }
+        pb.Init()
+        return pb
+    }
+
+    for _, policy := range []int{commonPool.OverflowDrop, commonPool.OverflowBlock} {
+        destroyed = 0
+        pb := newPool(policy)
+        b1, b2, b3 := pb.Get(), pb.Get(), pb.Get()
+        now := time.Now()
+        //超出MaxIdle的对象被丢弃，Put不会一直阻塞
+        pb.Put(b1)
+        pb.Put(b2)
+        pb.Put(b3)
+        fmt.Printf("policy %d put use time :%d ms\n", policy, time.Since(now)/time.Millisecond)
+        if destroyed != 2 {
+            t.Fatalf("policy %d expect 2 destroyed but got %d", policy, destroyed)
+        }
+        pb.Close()
+        if destroyed != 3 {
+            t.Fatalf("policy %d expect 3 destroyed but got %d", policy, destroyed)
+        }
+    }
+
+    destroyed = 0
+    pb := newPool(commonPool.OverflowGrow)
+    defer pb.Close()
+    b1, b2, b3 := pb.Get(), pb.Get(), pb.Get()
+    pb.Put(b1)
+    pb.Put(b2)
+    pb.Put(b3)
+    if destroyed != 0 {
+        t.Fatalf("expect 0 destroyed but got %d", destroyed)
+    }
+    //额外保存的对象可以再次借出，不会创建新对象
+    for i := 0; i < 3; i++ {
+        if _, err := pb.Borrow(); err != nil {
+            t.Fatal(err)
+        }
+    }
+
+    //丢弃不是由对象池创建的对象不释放名额，借出的对象数量不超过MaxSize
+    foreign := &commonPool.CommonPool{
+        MaxIdle:     1,
+        MaxSize:     1,
+        WaitTimeout: 20 * time.Millisecond,
+        New: func() interface{} {
+            return make([]byte, 10)
+        },
+    }
+    foreign.Init()
+    for i := 0; i < 3; i++ {
+        foreign.Put(make([]byte, 10))
+    }
+    //第一个借出的是空闲的外部对象，第二个是新创建的对象
+    for i := 0; i < 2; i++ {
+        if _, err := foreign.Borrow(); err != nil {
+            t.Fatal(err)
+        }
+    }
+    if _, err := foreign.Borrow(); !errors.Is(err, gomem.ErrTimeout) {
+        t.Fatalf("expect ErrTimeout but got %v", err)
+    }
+    ctx, cancel := context.WithCancel(context.Background())
+    cancel()
+    if n, _ := foreign.Shutdown(ctx); n != 1 {
+        t.Fatalf("expect 1 outstanding but got %d", n)
+    }
+}
+
+func TestCommonPool_new(t *testing.T) {
+    _, err := commonPool.NewCommonPool(&commonPool.CommonPool{
+        New: func() interface{} {
+            return 1
+        },
+        OverflowPolicy: 3,
+    })
+    if !errors.Is(err, gomem.ErrInvalidConfig) {
+        t.Fatalf("expect ErrInvalidConfig but got %v", err)
+    }
+
+    cfg := &commonPool.TypedCommonPool[int]{
+        New: func() int {
+            return 1
+        },
+        MaxSize:     1,
+        WaitTimeout: 10 * time.Millisecond,
+    }
+    pb, err := commonPool.NewTypedCommonPool(cfg)
+    if err != nil {
+        t.Fatal(err)
+    }
+    defer pb.Close()
+    cfg.MaxSize = 2
+    pb.Get()
+    if _, err := pb.Borrow(); !errors.Is(err, gomem.ErrTimeout) {
+        t.Fatalf("expect ErrTimeout but got %v", err)
+    }
+
+    //未调用Init时自动初始化
+    lazy := commonPool.TypedCommonPool[int]{
+        New: func() int {
+            return 2
+        },
+    }
+    defer lazy.Close()
+    if v, err := lazy.Borrow(); err != nil || v != 2 {
+        t.Fatalf("expect 2 but got %v %v", v, err)
+    }
+}
+
+func TestCommonPool_stats(t *testing.T) {
+    pb := commonPool.TypedCommonPool[[]byte]{
+        MaxSize: 1,
+        New: func() []byte {
+            return make([]byte, 10)
+        },
+        WaitTimeout: 20 * time.Millisecond,
+    }
+    pb.Init()
+    defer pb.Close()
+
+    b := pb.Get()
+    if _, err := pb.Borrow(); !errors.Is(err, gomem.ErrTimeout) {
+        t.Fatalf("expect ErrTimeout but got %v", err)
+    }
+    pb.Put(b)
+    st := pb.Stats()
+    fmt.Printf("stats %+v\n", st)
+    if st.Created != 1 || st.Borrowed != 1 || st.Returned != 1 || st.Timeouts != 1 || st.Idle != 1 || st.Active != 0 {
+        t.Fatalf("unexpected stats %+v", st)
+    }
+    if st.BorrowWait.Count != 1 || st.ActiveTime.Count != 1 || st.ActiveTime.Mean() <= 0 {
+        t.Fatalf("unexpected histogram %+v %+v", st.BorrowWait, st.ActiveTime)
+    }
+}
@@ -0,0 +1,55 @@
+/**
+ * Copyright (C) 2019, Xiongfa Li.
+ * All right reserved.
+ * @author xiongfa.li
+ * @date 2019/3/4
+ * @time 14:10
+ * @version V1.0
+ * Description: 
+ */
+
+package test
+
+import (
+    "github.com/xfali/gomem"
+    "testing"
+    "time"
+)
+
+func TestEvictionPolicy(t *testing.T) {
+    config := &gomem.EvictionConfig{
+        MinEvictableIdleTime:     time.Minute,
+        SoftMinEvictableIdleTime: time.Second,
+        MinIdle:                  2,
+    }
+    now := time.Now()
+    info := &gomem.PooledObjectInfo{
+        CreateTime:     now.Add(-time.Hour),
+        LastBorrowTime: now.Add(-10 * time.Second),
+        LastReturnTime: now.Add(-5 * time.Second),
+        BorrowCount:    3,
+    }
+
+    if (gomem.DefaultEvictionPolicy{}).Evict(config, info, 3) {
+        t.Fatal("idle time less than MinEvictableIdleTime")
+    }
+    if !(gomem.SoftMinEvictableIdleTimePolicy{}).Evict(config, info, 3) {
+        t.Fatal("idle time more than SoftMinEvictableIdleTime")
+    }
+    if (gomem.SoftMinEvictableIdleTimePolicy{}).Evict(config, info, 2) {
+        t.Fatal("idle count not more than MinIdle")
+    }
+    if !(gomem.MaxLifetimePolicy{MaxLifetime: time.Minute}).Evict(config, info, 1) {
+        t.Fatal("lifetime more than MaxLifetime")
+    }
+    if (gomem.MaxBorrowCountPolicy{MaxBorrowCount: 4}).Evict(config, info, 1) {
+        t.Fatal("borrow count less than MaxBorrowCount")
+    }
+    policy := gomem.AnyEvictionPolicy{
+        gomem.DefaultEvictionPolicy{},
+        gomem.MaxBorrowCountPolicy{MaxBorrowCount: 3},
+    }
+    if !policy.Evict(config, info, 1) {
+        t.Fatal("borrow count reach MaxBorrowCount")
+    }
+}
@@ -0,0 +1,220 @@
+/**
+ * Copyright (C) 2019, Xiongfa Li.
+ * All right reserved.
+ * @author xiongfa.li
+ * @date 2019/2/28
+ * @time 17:30
+ * @version V1.0
+ * Description: 
+ */
+
+package test
+
+import (
+    "context"
+    "errors"
+    "fmt"
+    "github.com/xfali/gomem"
+    commonPool2 "github.com/xfali/gomem/commonPool2"
+    "sync/atomic"
+    "testing"
+    "time"
+)
+
+func TestKeyedCommonPool(t *testing.T) {
+    count := 0
+    pb := commonPool2.TypedKeyedCommonPool[string, string]{
+        MaxSizePerKey:      2,
+        MaxTotal:           2,
+        BlockWhenExhausted: true,
+        MaxWaitMillis:      100 * time.Millisecond,
+        Factory: &commonPool2.TypedDefaultKeyedFactory[string, string]{
+            Make: func(key string) (string, error) {
+                count++
+                return fmt.Sprintf("%s-%d", key, count), nil
+            },
+            Destroy: func(key string, i string) {
+                fmt.Printf("DestroyObject %s %v\n", key, i)
+            },
+        },
+    }
+    pb.Init()
+    defer pb.Close()
+
+    a1 := pb.Get("a")
+    a2 := pb.Get("a")
+    _, err := pb.Borrow("a")
+    if !errors.Is(err, gomem.ErrTimeout) {
+        t.Fatalf("expect ErrTimeout but got %v", err)
+    }
+
+    //达到MaxTotal，销毁key a的空闲对象后为key b创建对象
+    pb.Put("a", a1)
+    b1, err := pb.Borrow("b")
+    if err != nil {
+        t.Fatal(err)
+    }
+    fmt.Printf("value %v %v %v\n", a1, a2, b1)
+
+    //等待者可以获得其他key释放的名额
+    go func() {
+        time.Sleep(50 * time.Millisecond)
+        pb.Put("a", a2)
+        pb.Clear("a")
+    }()
+    ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+    defer cancel()
+    b2, err := pb.GetContext(ctx, "b")
+    if err != nil {
+        t.Fatal(err)
+    }
+    fmt.Printf("value %v\n", b2)
+}
+
+func TestKeyedCommonPool_unknownObject(t *testing.T) {
+    destroyed := 0
+    pb := commonPool2.TypedKeyedCommonPool[string, string]{
+        MaxSizePerKey: 1,
+        MaxTotal:      1,
+        Factory: &commonPool2.TypedDefaultKeyedFactory[string, string]{
+            Make: func(key string) (string, error) {
+                return key + "-1", nil
+            },
+            Destroy: func(key string, i string) {
+                destroyed++
+            },
+        },
+    }
+    pb.Init()
+    defer pb.Close()
+
+    a, err := pb.Borrow("a")
+    if err != nil {
+        t.Fatal(err)
+    }
+    //不是由该key借出的对象被忽略，不会在销毁时释放其他对象的名额
+    pb.Put("a", "foreign")
+    pb.Put("b", "b-1")
+    pb.Put("a", a)
+    pb.Clear("a")
+    if destroyed != 1 {
+        t.Fatalf("expect 1 destroyed but got %d", destroyed)
+    }
+    if a, err = pb.Borrow("a"); err != nil {
+        t.Fatal(err)
+    }
+    if _, err := pb.Borrow("b"); !errors.Is(err, gomem.ErrExhausted) {
+        t.Fatalf("expect ErrExhausted but got %v", err)
+    }
+    pb.Put("a", a)
+}
+
+func TestKeyedCommonPool_shutdown(t *testing.T) {
+    var destroyed int32
+    pb := commonPool2.TypedKeyedCommonPool[string, *int]{
+        MaxSizePerKey:      1,
+        BlockWhenExhausted: true,
+        Factory: &commonPool2.TypedDefaultKeyedFactory[string, *int]{
+            Make: func(key string) (*int, error) {
+                return new(int), nil
+            },
+            Destroy: func(key string, i *int) {
+                atomic.AddInt32(&destroyed, 1)
+            },
+        },
+    }
+    pb.Init()
+
+    a := pb.Get("a")
+    b := pb.Get("b")
+    c := pb.Get("c")
+    //空闲对象在关闭时被销毁
+    pb.Put("c", c)
+    //阻塞等待的借用者在关闭时获得ErrClosed
+    waitErr := make(chan error, 1)
+    go func() {
+        _, err := pb.Borrow("a")
+        waitErr <- err
+    }()
+    go func() {
+        time.Sleep(50 * time.Millisecond)
+        pb.Put("b", b)
+    }()
+
+    ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+    defer cancel()
+    n, err := pb.Shutdown(ctx)
+    if n != 1 || !errors.Is(err, context.DeadlineExceeded) {
+        t.Fatalf("expect 1 outstanding but got %d, %v", n, err)
+    }
+    if err := <-waitErr; !errors.Is(err, gomem.ErrClosed) {
+        t.Fatalf("expect ErrClosed but got %v", err)
+    }
+    if _, err := pb.Borrow("a"); !errors.Is(err, gomem.ErrClosed) {
+        t.Fatalf("expect ErrClosed but got %v", err)
+    }
+    //关闭后归还的对象直接销毁
+    pb.Put("a", a)
+    if n := atomic.LoadInt32(&destroyed); n != 3 {
+        t.Fatalf("expect 3 destroyed but got %d", n)
+    }
+    if _, err := pb.Shutdown(context.Background()); !errors.Is(err, gomem.ErrClosed) {
+        t.Fatalf("expect ErrClosed but got %v", err)
+    }
+    pb.Close()
+}
+
+func TestKeyedCommonPool_new(t *testing.T) {
+    _, err := commonPool2.NewKeyedCommonPool(&commonPool2.KeyedCommonPool{})
+    if !errors.Is(err, gomem.ErrInvalidConfig) {
+        t.Fatalf("expect ErrInvalidConfig but got %v", err)
+    }
+
+    //未调用Init时自动初始化，重复Close不会panic
+    pb := commonPool2.TypedKeyedCommonPool[string, string]{
+        Factory: &commonPool2.TypedDefaultKeyedFactory[string, string]{
+            Make: func(key string) (string, error) {
+                return key + "-1", nil
+            },
+        },
+    }
+    v, err := pb.Borrow("a")
+    if err != nil || v != "a-1" {
+        t.Fatalf("expect a-1 but got %v %v", v, err)
+    }
+    pb.Put("a", v)
+    pb.Close()
+    pb.Close()
+    if _, err := pb.Borrow("a"); !errors.Is(err, gomem.ErrClosed) {
+        t.Fatalf("expect ErrClosed but got %v", err)
+    }
+}
+
+func TestKeyedCommonPool_stats(t *testing.T) {
+    pb := commonPool2.TypedKeyedCommonPool[string, string]{
+        MaxSizePerKey:      1,
+        BlockWhenExhausted: true,
+        MaxWaitMillis:      20 * time.Millisecond,
+        Factory: &commonPool2.TypedDefaultKeyedFactory[string, string]{
+            Make: func(key string) (string, error) {
+                return key + "-1", nil
+            },
+        },
+    }
+    pb.Init()
+    defer pb.Close()
+
+    a := pb.Get("a")
+    if _, err := pb.Borrow("a"); !errors.Is(err, gomem.ErrTimeout) {
+        t.Fatalf("expect ErrTimeout but got %v", err)
+    }
+    pb.Put("a", a)
+    st := pb.Stats()
+    fmt.Printf("stats %+v\n", st)
+    if st.Created != 1 || st.Borrowed != 1 || st.Returned != 1 || st.Timeouts != 1 || st.Idle != 1 || st.Active != 0 {
+        t.Fatalf("unexpected stats %+v", st)
+    }
+    if st.BorrowWait.Count != 1 || st.ActiveTime.Count != 1 {
+        t.Fatalf("unexpected histogram %+v %+v", st.BorrowWait, st.ActiveTime)
+    }
+}
@@ -0,0 +1,114 @@
+/**
+ * Copyright (C) 2019, Xiongfa Li.
+ * All right reserved.
+ * @author xiongfa.li
+ * @date 2019/3/25
+ * @time 14:30
+ * @version V1.0
+ * Description: 
+ */
+
+package test
+
+import (
+    "bytes"
+    "fmt"
+    "github.com/xfali/gomem/commonPool"
+    "github.com/xfali/gomem/recyclePool"
+    "log"
+    "os"
+    "runtime"
+    "strings"
+    "sync"
+    "testing"
+    "time"
+)
+
+func TestPoolBufferLeaks(t *testing.T) {
+    pb := recyclePool.TypedRecyclePool[*int]{
+        New: func() *int {
+            return new(int)
+        },
+        DetectLeaks:   true,
+        LeakThreshold: 10 * time.Millisecond,
+    }
+    defer pb.Close()
+
+    leaked := pb.Get()
+    pb.Put(pb.Get())
+    h, err := pb.BorrowHandle()
+    if err != nil {
+        t.Fatal(err)
+    }
+    h.Release()
+    h.Release()
+    if n := len(pb.Leaks()); n != 0 {
+        t.Fatalf("expect no leaks before threshold but got %d", n)
+    }
+
+    time.Sleep(20 * time.Millisecond)
+    leaks := pb.Leaks()
+    if len(leaks) != 1 || leaks[0].Obj != leaked {
+        t.Fatalf("expect 1 leak but got %v", leaks)
+    }
+    fmt.Printf("leak borrowed at %v\n%s", leaks[0].BorrowTime, leaks[0].Stack)
+    if !strings.Contains(string(leaks[0].Stack), "TestPoolBufferLeaks") {
+        t.Fatal("expect borrow stack")
+    }
+}
+
+//可并发写入的日志输出
+type syncBuffer struct {
+    mutex sync.Mutex
+    buf   bytes.Buffer
+}
+
+func (b *syncBuffer) Write(p []byte) (int, error) {
+    b.mutex.Lock()
+    defer b.mutex.Unlock()
+    return b.buf.Write(p)
+}
+
+func (b *syncBuffer) String() string {
+    b.mutex.Lock()
+    defer b.mutex.Unlock()
+    return b.buf.String()
+}
+
+func TestCommonPool_leakFinalizer(t *testing.T) {
+    out := &syncBuffer{}
+    log.SetOutput(out)
+    defer log.SetOutput(os.Stderr)
+
+    pb := commonPool.TypedCommonPool[[]byte]{
+        New: func() []byte {
+            return make([]byte, 10)
+        },
+        DetectLeaks: true,
+    }
+    defer pb.Close()
+
+    func() {
+        h, err := pb.BorrowHandle()
+        if err != nil {
+            t.Fatal(err)
+        }
+        //未Release即丢弃句柄
+        _ = h.Value()
+    }()
+    deadline := time.Now().Add(2 * time.Second)
+    for !strings.Contains(out.String(), "garbage collected without being returned") {
+        if time.Now().After(deadline) {
+            t.Fatal("expect leak log")
+        }
+        runtime.GC()
+        time.Sleep(10 * time.Millisecond)
+    }
+    fmt.Println(out.String())
+    if !strings.Contains(out.String(), "TestCommonPool_leakFinalizer") {
+        t.Fatal("expect borrow stack in log")
+    }
+    if n := len(pb.Leaks()); n != 1 {
+        t.Fatalf("expect 1 leak but got %d", n)
+    }
+}
@@ -0,0 +1,120 @@
+/**
+ * Copyright (C) 2019, Xiongfa Li.
+ * All right reserved.
+ * @author xiongfa.li
+ * @date 2019/3/12
+ * @time 10:20
+ * @version V1.0
+ * Description: 
+ */
+
+package test
+
+import (
+    commonPool2 "github.com/xfali/gomem/commonPool2"
+    "github.com/xfali/gomem/recyclePool"
+    "sync/atomic"
+    "testing"
+    "time"
+)
+
+//低负载下单个协程反复借出、归还对象，idle为结束时剩余的空闲对象数量。
+//FIFO时所有对象轮流被使用，始终不会被回收；LIFO时只有最近归还的对象被使用，其余对象被回收
+func BenchmarkCommonPool2_lifo(b *testing.B) {
+    for _, lifo := range []bool{false, true} {
+        name := "fifo"
+        if lifo {
+            name = "lifo"
+        }
+        b.Run(name, func(b *testing.B) {
+            pb := commonPool2.CommonPool{
+                MinIdle:                       1,
+                MaxSize:                       16,
+                BlockWhenExhausted:            true,
+                MinEvictableIdleTimeMillis:    50 * time.Millisecond,
+                TimeBetweenEvictionRunsMillis: 10 * time.Millisecond,
+                NumTestsPerEvictionRun:        -1,
+                Lifo:                          lifo,
+                Factory: &commonPool2.DefaultFactory{
+                    Make: func() interface{} { return make([]byte, 1024) },
+                },
+            }
+            pb.Init()
+            defer pb.Close()
+
+            bufs := make([]interface{}, 16)
+            for i := range bufs {
+                bufs[i] = pb.Get()
+            }
+            for i := range bufs {
+                pb.Put(bufs[i])
+            }
+
+            b.ResetTimer()
+            for i := 0; i < b.N; i++ {
+                pb.Put(pb.Get())
+            }
+            b.StopTimer()
+            b.ReportMetric(float64(pb.NumIdle()), "idle")
+        })
+    }
+}
+
+//deletes为被定时回收的对象数量
+func BenchmarkPoolBuffer_lifo(b *testing.B) {
+    for _, lifo := range []bool{false, true} {
+        name := "fifo"
+        if lifo {
+            name = "lifo"
+        }
+        b.Run(name, func(b *testing.B) {
+            var deletes int32
+            pb := recyclePool.RecyclePool{
+                MinEvictableIdleTimeMillis:    50 * time.Millisecond,
+                TimeBetweenEvictionRunsMillis: 10 * time.Millisecond,
+                Lifo:                          lifo,
+                New:                           func() interface{} { return make([]byte, 1024) },
+                Delete:                        func(interface{}) { atomic.AddInt32(&deletes, 1) },
+            }
+            pb.Init()
+            defer pb.Close()
+
+            bufs := make([]interface{}, 16)
+            for i := range bufs {
+                bufs[i] = pb.Get()
+            }
+            for i := range bufs {
+                pb.Put(bufs[i])
+            }
+
+            b.ResetTimer()
+            for i := 0; i < b.N; i++ {
+                pb.Put(pb.Get())
+            }
+            b.StopTimer()
+            b.ReportMetric(float64(atomic.LoadInt32(&deletes)), "deletes")
+        })
+    }
+}
+
+func TestCommonPool2_lifo(t *testing.T) {
+    pb := commonPool2.CommonPool{
+        MaxSize:            2,
+        BlockWhenExhausted: true,
+        Lifo:               true,
+        Factory: &commonPool2.DefaultFactory{
+            Make: func() interface{} { return new(int) },
+        },
+    }
+    pb.Init()
+    defer pb.Close()
+
+    o1 := pb.Get()
+    o2 := pb.Get()
+    pb.Put(o1)
+    pb.Put(o2)
+    //最近归还的对象最先借出
+    if o := pb.Get(); o != o2 {
+        t.Fatalf("expect %p but got %p", o2, o)
+    }
+}
@@ -0,0 +1,204 @@
+/**
+ * Copyright (C) 2019, Xiongfa Li.
+ * All right reserved.
+ * @author xiongfa.li
+ * @date 2019/3/22
+ * @time 16:45
+ * @version V1.0
+ * Description: 
+ */
+
+package test
+
+import (
+    "errors"
+    "fmt"
+    "github.com/xfali/gomem"
+    "github.com/xfali/gomem/commonPool"
+    commonPool2 "github.com/xfali/gomem/commonPool2"
+    "github.com/xfali/gomem/recyclePool"
+    "sync"
+    "testing"
+    "time"
+)
+
+//按顺序记录收到的事件
+type recorder struct {
+    gomem.PoolListenerFuncs
+    mutex  sync.Mutex
+    events []gomem.PoolEvent
+}
+
+func newRecorder() *recorder {
+    r := &recorder{}
+    add := func(e gomem.PoolEvent) {
+        r.mutex.Lock()
+        defer r.mutex.Unlock()
+        r.events = append(r.events, e)
+    }
+    r.PoolListenerFuncs = gomem.PoolListenerFuncs{
+        Create: add, Activate: add, Borrow: add, Return: add,
+        Evict: add, Invalidate: add, Destroy: add, Timeout: add,
+    }
+    return r
+}
+
+//等待收到n个事件后返回事件类型
+func (r *recorder) wait(t *testing.T, n int) []gomem.EventType {
+    deadline := time.Now().Add(time.Second)
+    for {
+        r.mutex.Lock()
+        if len(r.events) >= n {
+            types := make([]gomem.EventType, len(r.events))
+            for i, e := range r.events {
+                types[i] = e.Type
+            }
+            r.mutex.Unlock()
+            return types
+        }
+        r.mutex.Unlock()
+        if time.Now().After(deadline) {
+            t.Fatalf("expect %d events", n)
+        }
+        time.Sleep(time.Millisecond)
+    }
+}
+
+func (r *recorder) event(i int) gomem.PoolEvent {
+    r.mutex.Lock()
+    defer r.mutex.Unlock()
+    return r.events[i]
+}
+
+func expectEvents(t *testing.T, got []gomem.EventType, expect ...gomem.EventType) {
+    fmt.Printf("events %v\n", got)
+    if len(got) != len(expect) {
+        t.Fatalf("expect %v but got %v", expect, got)
+    }
+    for i := range expect {
+        if got[i] != expect[i] {
+            t.Fatalf("expect %v but got %v", expect, got)
+        }
+    }
+}
+
+func TestCommonPool2_listener(t *testing.T) {
+    pb := commonPool2.CommonPool{
+        Factory: &commonPool2.DefaultFactory{
+            Make: func() interface{} {
+                return make([]byte, 10)
+            },
+        },
+        MaxSize:            1,
+        BlockWhenExhausted: true,
+        MaxWaitMillis:      10 * time.Millisecond,
+    }
+    r := newRecorder()
+    pb.AddListener(r)
+    defer pb.Close()
+
+    o := pb.Get()
+    if _, err := pb.Borrow(); !errors.Is(err, gomem.ErrTimeout) {
+        t.Fatalf("expect ErrTimeout but got %v", err)
+    }
+    pb.Put(o)
+    o = pb.Get()
+    if err := pb.InvalidateObject(o); err != nil {
+        t.Fatal(err)
+    }
+    //销毁后内部协程会再创建对象，只比较前10个事件
+    expectEvents(t, r.wait(t, 10)[:10],
+        gomem.EventCreate, gomem.EventActivate, gomem.EventBorrow, gomem.EventTimeout,
+        gomem.EventReturn, gomem.EventActivate, gomem.EventBorrow, gomem.EventInvalidate, gomem.EventDestroy,
+        gomem.EventCreate)
+    if e := r.event(1); e.From != commonPool2.ALLOCATED {
+        t.Fatalf("expect activate from ALLOCATED but got %d", e.From)
+    }
+    if e := r.event(5); e.From != commonPool2.IDLE {
+        t.Fatalf("expect activate from IDLE but got %d", e.From)
+    }
+    if e := r.event(3); e.Duration < 10*time.Millisecond {
+        t.Fatalf("expect timeout after 10ms but got %v", e.Duration)
+    }
+}
+
+func TestCommonPool_listener(t *testing.T) {
+    pb := commonPool.CommonPool{
+        MaxSize: 1,
+        New: func() interface{} {
+            return make([]byte, 10)
+        },
+        WaitTimeout: 10 * time.Millisecond,
+    }
+    r := newRecorder()
+    pb.AddListener(r)
+
+    o := pb.Get()
+    if _, err := pb.Borrow(); !errors.Is(err, gomem.ErrTimeout) {
+        t.Fatalf("expect ErrTimeout but got %v", err)
+    }
+    time.Sleep(5 * time.Millisecond)
+    pb.Put(o)
+    pb.Close()
+    expectEvents(t, r.wait(t, 5),
+        gomem.EventCreate, gomem.EventBorrow, gomem.EventTimeout, gomem.EventReturn, gomem.EventDestroy)
+    if e := r.event(3); e.From != gomem.ALLOCATED || e.Duration < 5*time.Millisecond {
+        t.Fatalf("unexpected return event %+v", e)
+    }
+}
+
+func TestPoolBufferListener(t *testing.T) {
+    pb := recyclePool.RecyclePool{
+        New: func() interface{} {
+            return make([]byte, 10)
+        },
+        MaxLifetime: 20 * time.Millisecond,
+    }
+    r := newRecorder()
+    pb.AddListener(r)
+    defer pb.Close()
+
+    o := pb.Get()
+    time.Sleep(30 * time.Millisecond)
+    //超过MaxLifetime的对象归还时被释放
+    pb.Put(o)
+    //内部协程预先创建对象的时机不确定，忽略创建事件及预先创建的对象过期产生的事件
+    var got []gomem.EventType
+    for n := 4; len(got) < 4; n++ {
+        got = got[:0]
+        for i, typ := range r.wait(t, n) {
+            if typ != gomem.EventCreate && fmt.Sprintf("%p", r.event(i).Obj) == fmt.Sprintf("%p", o) {
+                got = append(got, typ)
+            }
+        }
+    }
+    expectEvents(t, got[:4], gomem.EventBorrow, gomem.EventReturn, gomem.EventEvict, gomem.EventDestroy)
+}
+
+func TestPoolBufferSlowListener(t *testing.T) {
+    pb := recyclePool.RecyclePool{
+        New: func() interface{} {
+            return make([]byte, 10)
+        },
+    }
+    block := make(chan bool)
+    pb.AddListener(&gomem.PoolListenerFuncs{
+        Create: func(e gomem.PoolEvent) {
+            <-block
+        },
+    })
+    defer pb.Close()
+    defer close(block)
+
+    //监听器阻塞时对象池不受影响，超出的事件被丢弃
+    start := time.Now()
+    for i := 0; i < 2000; i++ {
+        pb.Put(pb.Get())
+    }
+    if d := time.Since(start); d > 5*time.Second {
+        t.Fatalf("pool blocked by listener for %v", d)
+    }
+    if n := pb.Stats().DroppedEvents; n == 0 {
+        t.Fatal("expect dropped events")
+    }
+}
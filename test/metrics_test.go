@@ -0,0 +1,79 @@
+/**
+ * Copyright (C) 2019, Xiongfa Li.
+ * All right reserved.
+ * @author xiongfa.li
+ * @date 2019/3/21
+ * @time 17:05
+ * @version V1.0
+ * Description: 
+ */
+
+package test
+
+import (
+    "errors"
+    "expvar"
+    "fmt"
+    commonPool2 "github.com/xfali/gomem/commonPool2"
+    "github.com/xfali/gomem/metrics"
+    "github.com/xfali/gomem/recyclePool"
+    "net/http/httptest"
+    "strings"
+    "testing"
+)
+
+func TestMetrics(t *testing.T) {
+    p2 := commonPool2.TypedCommonPool[int]{
+        Factory: &commonPool2.TypedDefaultFactory[int]{
+            Make: func() int {
+                return 1
+            },
+        },
+    }
+    defer p2.Close()
+    rp := recyclePool.RecyclePool{
+        New: func() interface{} {
+            return make([]byte, 10)
+        },
+    }
+    defer rp.Close()
+
+    if err := metrics.Register("conn", &p2); err != nil {
+        t.Fatal(err)
+    }
+    defer metrics.Unregister("conn")
+    if err := metrics.Register(`buf"1`, &rp); err != nil {
+        t.Fatal(err)
+    }
+    defer metrics.Unregister(`buf"1`)
+    if err := metrics.Register("conn", &p2); !errors.Is(err, metrics.ErrDuplicateName) {
+        t.Fatalf("expect ErrDuplicateName but got %v", err)
+    }
+
+    p2.Put(p2.Get())
+    rp.Get()
+
+    w := httptest.NewRecorder()
+    metrics.Handler().ServeHTTP(w, httptest.NewRequest("GET", "/metrics", nil))
+    body := w.Body.String()
+    fmt.Println(body)
+    for _, line := range []string{
+        "# TYPE gomem_pool_idle gauge",
+        `gomem_pool_active{pool="buf\"1"} 1`,
+        `gomem_pool_borrowed_total{pool="conn"} 1`,
+        `gomem_pool_returned_total{pool="conn"} 1`,
+        "# TYPE gomem_pool_borrow_wait_seconds histogram",
+        `gomem_pool_borrow_wait_seconds_count{pool="conn"} 1`,
+        `gomem_pool_active_seconds_bucket{pool="conn",le="+Inf"} 1`,
+    } {
+        if !strings.Contains(body, line+"\n") {
+            t.Fatalf("expect line %s", line)
+        }
+    }
+
+    v := expvar.Get("gomem").String()
+    fmt.Println(v)
+    if !strings.Contains(v, `"conn"`) || !strings.Contains(v, `"Borrowed":1`) {
+        t.Fatalf("unexpected expvar %s", v)
+    }
+}
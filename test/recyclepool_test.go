@@ -12,10 +12,15 @@ package test
 
 import (
     "container/list"
+    "context"
+    "errors"
     "fmt"
+    "github.com/xfali/gomem"
     "github.com/xfali/gomem/recyclePool"
     "math/rand"
     "runtime"
+    "sync"
+    "sync/atomic"
     "testing"
     "time"
 )
@@ -96,6 +101,116 @@ func TestPoolBuffer2(t *testing.T) {
 
 }
 
+func TestPoolBufferGetContext(t *testing.T) {
+    pb := recyclePool.RecyclePool{
+        New: func() interface{} {
+            return make([]byte, 1000)
+        },
+    }
+    pb.Init()
+    defer pb.Close()
+
+    ctx, cancel := context.WithCancel(context.Background())
+    buf, err := pb.GetContext(ctx)
+    if err != nil || buf == nil {
+        t.Fatalf("expect object but got %v, %v", buf, err)
+    }
+    pb.Put(buf)
+
+    cancel()
+    _, err = pb.GetContext(ctx)
+    if err != context.Canceled {
+        t.Fatalf("expect Canceled but got %v", err)
+    }
+}
+
+func TestPoolBufferTyped(t *testing.T) {
+    var pb gomem.TypedPool[[]byte] = &recyclePool.TypedRecyclePool[[]byte]{
+        New: func() []byte {
+            return make([]byte, 1000)
+        },
+    }
+    get, give := pb.Init()
+    defer pb.Close()
+
+    buf := <-get
+    if len(buf) != 1000 {
+        t.Fatalf("expect 1000 bytes but got %d", len(buf))
+    }
+    give <- buf
+}
+
+func TestPoolBufferEvictionPolicy(t *testing.T) {
+    deleted := make(chan []byte, 2)
+    pb := recyclePool.TypedRecyclePool[[]byte]{
+        New: func() []byte {
+            return make([]byte, 1000)
+        },
+        Delete: func(b []byte) {
+            deleted <- b
+        },
+        TimeBetweenEvictionRunsMillis: 50 * time.Millisecond,
+        EvictionPolicy:                gomem.MaxBorrowCountPolicy{MaxBorrowCount: 2},
+    }
+    pb.Init()
+    defer pb.Close()
+
+    //队列为FIFO，借出时内部协程会预先创建下一个对象，两个对象交替借出
+    for i := 0; i < 4; i++ {
+        pb.Put(pb.Get())
+    }
+
+    select {
+    case <-deleted:
+    case <-time.After(time.Second):
+        t.Fatal("object not deleted")
+    }
+}
+
+func TestPoolBufferUncomparable(t *testing.T) {
+    id := 0
+    pb := recyclePool.TypedRecyclePool[uncomparable]{
+        New: func() uncomparable {
+            id++
+            return uncomparable{id, make([]byte, 8)}
+        },
+        MaxLifetime: time.Hour,
+        Lifo:        true,
+    }
+    pb.Init()
+    defer pb.Close()
+
+    a := pb.Get()
+    b := pb.Get()
+    pb.Put(a)
+    //归还的是a，再次借出的也必须是a，而不是仍被借出的b
+    if c := pb.Get(); c.id != a.id {
+        t.Fatalf("expect object %d but got %d", a.id, c.id)
+    }
+    pb.Put(b)
+}
+
+func TestPoolBufferMaxLifetime(t *testing.T) {
+    pb := recyclePool.TypedRecyclePool[*time.Time]{
+        New: func() *time.Time {
+            now := time.Now()
+            return &now
+        },
+        MaxLifetime: 50 * time.Millisecond,
+    }
+    pb.Init()
+    defer pb.Close()
+
+    pb.Put(pb.Get())
+    time.Sleep(150 * time.Millisecond)
+    //空闲期间过期的对象不会被借出
+    created := pb.Get()
+    if age := time.Since(*created); age >= 50*time.Millisecond {
+        t.Fatalf("expect a new object but got one aged %v", age)
+    }
+    pb.Put(created)
+}
+
 func TestTimer(t *testing.T) {
     timer := time.NewTimer(time.Second)
     for {
@@ -107,3 +222,255 @@ func TestTimer(t *testing.T) {
         }
     }
 }
+
+func TestPoolBufferMaxSize(t *testing.T) {
+    var deleted int32
+    pb := recyclePool.RecyclePool{
+        MaxSize:       2,
+        MaxIdle:       1,
+        WhenExhausted: recyclePool.WhenExhaustedFail,
+        New: func() interface{} {
+            return make([]byte, 10)
+        },
+        Delete: func(i interface{}) {
+            atomic.AddInt32(&deleted, 1)
+        },
+    }
+    pb.Init()
+    defer pb.Close()
+
+    b1, _ := pb.Borrow()
+    b2, err := pb.Borrow()
+    if err != nil {
+        t.Fatal(err)
+    }
+    if _, err := pb.Borrow(); !errors.Is(err, gomem.ErrExhausted) {
+        t.Fatalf("expect ErrExhausted but got %v", err)
+    }
+    pb.Put(b1)
+    //空闲对象已达到MaxIdle，归还的对象被释放
+    pb.Put(b2)
+    //借出操作由内部协程处理，保证归还已完成
+    pb.Get()
+    if n := atomic.LoadInt32(&deleted); n != 1 {
+        t.Fatalf("expect 1 deleted but got %d", n)
+    }
+
+    //阻塞等待对象归还
+    pb2 := recyclePool.RecyclePool{
+        MaxSize: 1,
+        New: func() interface{} {
+            return make([]byte, 10)
+        },
+    }
+    get, give := pb2.Init()
+    defer pb2.Close()
+    buf := <-get
+    go func() {
+        time.Sleep(50 * time.Millisecond)
+        give <- buf
+    }()
+    ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+    defer cancel()
+    if _, err := pb2.GetContext(ctx); !errors.Is(err, context.DeadlineExceeded) {
+        t.Fatalf("expect DeadlineExceeded but got %v", err)
+    }
+    if _, err := pb2.Borrow(); err != nil {
+        t.Fatal(err)
+    }
+}
+
+func TestPoolBufferNilObject(t *testing.T) {
+    made := 0
+    pb := recyclePool.RecyclePool{
+        MaxSize:       1,
+        WhenExhausted: recyclePool.WhenExhaustedFail,
+        New: func() interface{} {
+            made++
+            if made == 1 {
+                return nil
+            }
+            return make([]byte, 10)
+        },
+    }
+    pb.Init()
+    defer pb.Close()
+
+    if _, err := pb.Borrow(); !errors.Is(err, gomem.ErrFactory) {
+        t.Fatalf("expect ErrFactory but got %v", err)
+    }
+    //New返回的nil不占用MaxSize名额
+    buf, err := pb.Borrow()
+    if err != nil {
+        t.Fatal(err)
+    }
+    if s := pb.Stats(); s.Active != 1 {
+        t.Fatalf("expect 1 active but got %d", s.Active)
+    }
+    pb.Put(buf)
+    if s := pb.Stats(); s.Active != 0 {
+        t.Fatalf("expect 0 active but got %d", s.Active)
+    }
+}
+
+func TestPoolBufferUnpooled(t *testing.T) {
+    var deleted int32
+    pb := recyclePool.RecyclePool{
+        MaxSize:       1,
+        WhenExhausted: recyclePool.WhenExhaustedNew,
+        New: func() interface{} {
+            return make([]byte, 10)
+        },
+        Delete: func(i interface{}) {
+            atomic.AddInt32(&deleted, 1)
+        },
+    }
+    pb.Init()
+    defer pb.Close()
+
+    b1 := pb.Get()
+    b2, err := pb.Borrow()
+    if err != nil {
+        t.Fatal(err)
+    }
+    pb.Put(b1)
+    //超出MaxSize的对象被释放
+    pb.Put(b2)
+    pb.Get()
+    if n := atomic.LoadInt32(&deleted); n != 1 {
+        t.Fatalf("expect 1 deleted but got %d", n)
+    }
+}
+
+func TestPoolBufferShutdown(t *testing.T) {
+    var deleted int32
+    pb := recyclePool.RecyclePool{
+        New: func() interface{} {
+            return make([]byte, 10)
+        },
+        Delete: func(i interface{}) {
+            atomic.AddInt32(&deleted, 1)
+        },
+    }
+    pb.Init()
+
+    b1 := pb.Get()
+    b2 := pb.Get()
+    pb.Put(b1)
+    go func() {
+        time.Sleep(50 * time.Millisecond)
+        pb.Put(b2)
+    }()
+    //空闲的b1、预先创建的对象及归还的b2均被释放
+    n, err := pb.Shutdown(context.Background())
+    if n != 0 || err != nil {
+        t.Fatalf("expect 0 outstanding but got %d, %v", n, err)
+    }
+    if n := atomic.LoadInt32(&deleted); n != 3 {
+        t.Fatalf("expect 3 deleted but got %d", n)
+    }
+    if _, err := pb.Borrow(); !errors.Is(err, gomem.ErrClosed) {
+        t.Fatalf("expect ErrClosed but got %v", err)
+    }
+    pb.Put(b1)
+    pb.Close()
+}
+
+func TestPoolBufferNew(t *testing.T) {
+    _, err := recyclePool.NewRecyclePool(&recyclePool.RecyclePool{})
+    if !errors.Is(err, gomem.ErrInvalidConfig) {
+        t.Fatalf("expect ErrInvalidConfig but got %v", err)
+    }
+    _, err = recyclePool.NewRecyclePool(&recyclePool.RecyclePool{
+        New: func() interface{} {
+            return make([]byte, 10)
+        },
+        MaxSize: -1,
+    })
+    if !errors.Is(err, gomem.ErrInvalidConfig) {
+        t.Fatalf("expect ErrInvalidConfig but got %v", err)
+    }
+
+    cfg := &recyclePool.RecyclePool{
+        New: func() interface{} {
+            return make([]byte, 10)
+        },
+        MaxSize:       1,
+        WhenExhausted: recyclePool.WhenExhaustedFail,
+    }
+    pb, err := recyclePool.NewRecyclePool(cfg)
+    if err != nil {
+        t.Fatal(err)
+    }
+    defer pb.Close()
+    //创建后修改配置不影响对象池
+    cfg.MaxSize = 2
+    b1 := pb.Get()
+    if _, err := pb.Borrow(); !errors.Is(err, gomem.ErrExhausted) {
+        t.Fatalf("expect ErrExhausted but got %v", err)
+    }
+    pb.Put(b1)
+}
+
+func TestPoolBufferLazyInit(t *testing.T) {
+    pb := recyclePool.RecyclePool{
+        New: func() interface{} {
+            return make([]byte, 10)
+        },
+    }
+    //未调用Init时自动初始化，并发调用Init只初始化一次
+    var wg sync.WaitGroup
+    for i := 0; i < 8; i++ {
+        wg.Add(1)
+        go func(i int) {
+            defer wg.Done()
+            if i%2 == 0 {
+                pb.Init()
+                return
+            }
+            pb.Put(pb.Get())
+        }(i)
+    }
+    wg.Wait()
+    if b := pb.Get(); b == nil {
+        t.Fatal("expect object but got nil")
+    }
+    pb.Close()
+
+    empty := recyclePool.RecyclePool{}
+    if _, err := empty.Borrow(); !errors.Is(err, gomem.ErrInvalidConfig) {
+        t.Fatalf("expect ErrInvalidConfig but got %v", err)
+    }
+}
+
+func TestPoolBufferStats(t *testing.T) {
+    pb := recyclePool.TypedRecyclePool[[]byte]{
+        New: func() []byte {
+            return make([]byte, 10)
+        },
+        MaxSize:     1,
+        MaxLifetime: time.Hour,
+    }
+    pb.Init()
+    defer pb.Close()
+
+    b := pb.Get()
+    ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+    defer cancel()
+    if _, err := pb.GetContext(ctx); !errors.Is(err, context.DeadlineExceeded) {
+        t.Fatalf("expect DeadlineExceeded but got %v", err)
+    }
+    st := pb.Stats()
+    if st.Active != 1 || st.Idle != 0 || st.Timeouts != 1 {
+        t.Fatalf("unexpected stats %+v", st)
+    }
+    pb.Put(b)
+    st = pb.Stats()
+    fmt.Printf("stats %+v\n", st)
+    if st.Created != 1 || st.Borrowed != 1 || st.Returned != 1 || st.Idle != 1 || st.Active != 0 {
+        t.Fatalf("unexpected stats %+v", st)
+    }
+    if st.BorrowWait.Count != 1 || st.ActiveTime.Count != 1 {
+        t.Fatalf("unexpected histogram %+v %+v", st.BorrowWait, st.ActiveTime)
+    }
+}
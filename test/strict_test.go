@@ -0,0 +1,169 @@
+/**
+ * Copyright (C) 2019, Xiongfa Li.
+ * All right reserved.
+ * @author xiongfa.li
+ * @date 2019/3/27
+ * @time 17:10
+ * @version V1.0
+ * Description: 
+ */
+
+package test
+
+import (
+    "errors"
+    "fmt"
+    "github.com/xfali/gomem"
+    "github.com/xfali/gomem/commonPool"
+    commonPool2 "github.com/xfali/gomem/commonPool2"
+    "github.com/xfali/gomem/recyclePool"
+    "testing"
+    "time"
+)
+
+//f应panic且panic的值为包装了target的error
+func expectPanic(t *testing.T, target error, f func()) {
+    t.Helper()
+    defer func() {
+        r := recover()
+        fmt.Println("recover:", r)
+        err, ok := r.(error)
+        if !ok || !errors.Is(err, target) {
+            t.Fatalf("expect panic %v but got %v", target, r)
+        }
+    }()
+    f()
+}
+
+func TestPoolBufferStrict(t *testing.T) {
+    pb := recyclePool.TypedRecyclePool[[]byte]{
+        New: func() []byte {
+            return make([]byte, 4)
+        },
+        Strict:         true,
+        PoisonOnReturn: true,
+    }
+    pb.Init()
+    defer pb.Close()
+
+    b := pb.Get()
+    b[0] = 1
+    pb.Put(b)
+    //归还后继续使用将读到填充的字节
+    if b[0] != gomem.PoisonByte || b[3] != gomem.PoisonByte {
+        t.Fatalf("expect poisoned buffer but got %v", b)
+    }
+    expectPanic(t, gomem.ErrDoubleReturn, func() { pb.Put(b) })
+    expectPanic(t, gomem.ErrUnknownObject, func() { pb.Put(make([]byte, 4)) })
+
+    h, err := pb.BorrowHandle()
+    if err != nil {
+        t.Fatal(err)
+    }
+    h.Release()
+    h.Release()
+}
+
+func TestCommonPool_strict(t *testing.T) {
+    pb := commonPool.TypedCommonPool[*int]{
+        MaxSize:     1,
+        WaitTimeout: 20 * time.Millisecond,
+        New: func() *int {
+            return new(int)
+        },
+        Strict: true,
+    }
+    pb.Init()
+    defer pb.Close()
+
+    i := pb.Get()
+    pb.Put(i)
+    expectPanic(t, gomem.ErrDoubleReturn, func() { pb.Put(i) })
+    expectPanic(t, gomem.ErrUnknownObject, func() { pb.Put(new(int)) })
+    //重复归还被拒绝，对象只能被借出一次
+    if j := pb.Get(); j != i {
+        t.Fatal("expect the same object")
+    }
+    if _, err := pb.Borrow(); !errors.Is(err, gomem.ErrTimeout) {
+        t.Fatalf("expect ErrTimeout but got %v", err)
+    }
+}
+
+func TestCommonPool2_strict(t *testing.T) {
+    destroyed := 0
+    pb := commonPool2.TypedCommonPool[[]byte]{
+        MaxSize: 2,
+        Factory: &commonPool2.TypedDefaultFactory[[]byte]{
+            Make: func() []byte {
+                return make([]byte, 4)
+            },
+            Destroy: func(b []byte) {
+                destroyed++
+            },
+        },
+        Strict:         true,
+        PoisonOnReturn: true,
+    }
+    pb.Init()
+    defer pb.Close()
+
+    b := pb.Get()
+    pb.Put(b)
+    if b[0] != gomem.PoisonByte {
+        t.Fatalf("expect poisoned buffer but got %v", b)
+    }
+    expectPanic(t, gomem.ErrDoubleReturn, func() { pb.Put(b) })
+    expectPanic(t, gomem.ErrUnknownObject, func() { pb.Put(make([]byte, 4)) })
+
+    //销毁后不再跟踪
+    b = pb.Get()
+    if err := pb.InvalidateObject(b); err != nil {
+        t.Fatal(err)
+    }
+    expectPanic(t, gomem.ErrUnknownObject, func() { pb.Put(b) })
+    if st := pb.Stats(); st.Active != 0 || destroyed != 1 {
+        t.Fatalf("unexpected stats %+v, destroyed %d", st, destroyed)
+    }
+
+    //接受外部对象，但外部对象同样不能重复归还
+    ext := commonPool2.TypedCommonPool[[]byte]{
+        MaxSize: 2,
+        Factory: &commonPool2.TypedDefaultFactory[[]byte]{
+            Make: func() []byte {
+                return make([]byte, 4)
+            },
+        },
+        Strict:            true,
+        AcceptExternalObj: true,
+    }
+    ext.Init()
+    defer ext.Close()
+    e := make([]byte, 4)
+    ext.Put(e)
+    expectPanic(t, gomem.ErrDoubleReturn, func() { ext.Put(e) })
+    //外部对象只加入对象池一次
+    if st := ext.Stats(); st.Idle != int(st.Created)+1 {
+        t.Fatalf("expect external object idle once but got %+v", st)
+    }
+}
+
+func TestKeyedCommonPool_strict(t *testing.T) {
+    pb := commonPool2.TypedKeyedCommonPool[string, *string]{
+        Factory: &commonPool2.TypedDefaultKeyedFactory[string, *string]{
+            Make: func(key string) (*string, error) {
+                return &key, nil
+            },
+        },
+        Strict: true,
+    }
+    pb.Init()
+    defer pb.Close()
+
+    a := pb.Get("a")
+    expectPanic(t, gomem.ErrUnknownObject, func() { pb.Put("b", a) })
+    pb.Put("a", a)
+    expectPanic(t, gomem.ErrDoubleReturn, func() { pb.Put("a", a) })
+    if st := pb.Stats(); st.Idle != 1 || st.Returned != 1 {
+        t.Fatalf("unexpected stats %+v", st)
+    }
+}